@@ -23,6 +23,10 @@ func run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return runMigrate(ctx, os.Args[2:])
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		return err
@@ -0,0 +1,63 @@
+package agent
+
+import "context"
+
+// Conversational is a voice agent that can hold a phone conversation.
+// Audio in both directions is base64 encoded 8 kHz μ-law, the format used by
+// Twilio media streams.
+type Conversational interface {
+	Start(ctx context.Context, params StartParams) (Session, error)
+}
+
+// Session is a single running conversation.
+type Session interface {
+	// SendAudio streams a chunk of caller audio to the agent.
+	SendAudio(payload string) error
+	// Events delivers everything the agent produces. The channel is closed
+	// when the conversation is over.
+	Events() <-chan Event
+	// SendToolResult answers an EventToolCall.
+	SendToolResult(callID, result string, isError bool) error
+	// End stops the conversation. It is safe to call more than once.
+	End() error
+}
+
+type StartParams struct {
+	Prompt           string
+	FirstMessage     string
+	DynamicVariables map[string]string
+}
+
+type EventType string
+
+const (
+	// the agent accepted the conversation and assigned it an id
+	EventStarted EventType = "started"
+	// agent speech to play to the caller
+	EventAudio EventType = "audio"
+	// the caller spoke over the agent; buffered speech should be dropped
+	EventInterruption   EventType = "interruption"
+	EventAgentResponse  EventType = "agent_response"
+	EventUserTranscript EventType = "user_transcript"
+	// the agent invoked a client tool and waits for its result
+	EventToolCall EventType = "tool_call"
+)
+
+type Event struct {
+	Type           EventType
+	ConversationID string
+	// base64 μ-law audio for EventAudio
+	Audio string
+	// transcript text for EventAgentResponse and EventUserTranscript
+	Text string
+	// set for EventToolCall
+	ToolCall *ToolCall
+}
+
+// ToolCall is a client tool invocation, e.g. the opt_out tool the agent uses
+// when the debtor asks not to be contacted again.
+type ToolCall struct {
+	ID         string
+	Name       string
+	Parameters map[string]interface{}
+}
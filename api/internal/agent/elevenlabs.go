@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"claimsio/internal/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+const DefaultElevenLabsBaseURL = "https://api.elevenlabs.io"
+
+// ElevenLabs runs conversations on the ElevenLabs ConvAI platform.
+type ElevenLabs struct {
+	BaseURL    string
+	APIKey     string
+	AgentID    string
+	HTTPClient *http.Client
+	Dialer     *websocket.Dialer
+}
+
+func NewElevenLabs(apiKey, agentID string) *ElevenLabs {
+	return &ElevenLabs{
+		BaseURL:    DefaultElevenLabsBaseURL,
+		APIKey:     apiKey,
+		AgentID:    agentID,
+		HTTPClient: http.DefaultClient,
+		Dialer:     websocket.DefaultDialer,
+	}
+}
+
+func (e *ElevenLabs) Start(ctx context.Context, params StartParams) (Session, error) {
+	signedURL, err := e.signedURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, _, err := e.Dialer.DialContext(ctx, signedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to elevenlabs: %w", err)
+	}
+
+	config := protocol.ConversationInitiationClientData{
+		Type: protocol.ElevenLabsConversationInitiationClientData,
+	}
+	config.ConversationConfigOverride.Agent.Prompt.Prompt = params.Prompt
+	config.ConversationConfigOverride.Agent.FirstMessage = params.FirstMessage
+	config.ClientData.DynamicVariables = params.DynamicVariables
+
+	if err := ws.WriteJSON(config); err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	s := &elevenLabsSession{
+		conn:   ws,
+		events: make(chan Event, 64),
+		done:   make(chan struct{}),
+	}
+	go s.read()
+
+	return s, nil
+}
+
+func (e *ElevenLabs) signedURL(ctx context.Context) (string, error) {
+	endpoint := fmt.Sprintf("%s/v1/convai/conversation/get_signed_url?agent_id=%s",
+		e.BaseURL, url.QueryEscape(e.AgentID))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("xi-api-key", e.APIKey)
+
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get signed URL: %s", resp.Status)
+	}
+
+	var result struct {
+		SignedURL string `json:"signed_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	return result.SignedURL, nil
+}
+
+type elevenLabsSession struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	events  chan Event
+
+	done    chan struct{}
+	endOnce sync.Once
+}
+
+func (s *elevenLabsSession) Events() <-chan Event {
+	return s.events
+}
+
+func (s *elevenLabsSession) SendAudio(payload string) error {
+	return s.write(protocol.UserAudioChunk{UserAudioChunk: payload})
+}
+
+func (s *elevenLabsSession) SendToolResult(callID, result string, isError bool) error {
+	return s.write(protocol.NewClientToolResult(callID, result, isError))
+}
+
+func (s *elevenLabsSession) End() error {
+	var err error
+	s.endOnce.Do(func() {
+		close(s.done)
+		s.write(protocol.EndConversation{Type: protocol.ElevenLabsEndConversation})
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (s *elevenLabsSession) write(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteJSON(v)
+}
+
+// read translates ConvAI events until the socket closes. Pings are answered
+// here so callers only see conversation events.
+func (s *elevenLabsSession) read() {
+	defer close(s.events)
+
+	for {
+		_, message, err := s.conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				fmt.Printf("Error reading from ElevenLabs: %v\n", err)
+			}
+			return
+		}
+
+		msg, err := protocol.DecodeElevenLabs(message)
+		if err != nil {
+			fmt.Printf("Error parsing ElevenLabs message: %v\n", err)
+			continue
+		}
+
+		var event Event
+		switch msg.Type {
+		case protocol.ElevenLabsConversationInitiationMetadata:
+			event = Event{Type: EventStarted, ConversationID: msg.ConversationInitiationMetadata.ConversationID}
+		case protocol.ElevenLabsAudio:
+			event = Event{Type: EventAudio, Audio: msg.Audio.AudioBase64}
+		case protocol.ElevenLabsInterruption:
+			event = Event{Type: EventInterruption}
+		case protocol.ElevenLabsAgentResponse:
+			event = Event{Type: EventAgentResponse, Text: msg.AgentResponse.AgentResponse}
+		case protocol.ElevenLabsUserTranscript:
+			event = Event{Type: EventUserTranscript, Text: msg.UserTranscript.UserTranscript}
+		case protocol.ElevenLabsClientToolCall:
+			event = Event{Type: EventToolCall, ToolCall: &ToolCall{
+				ID:         msg.ClientToolCall.ToolCallID,
+				Name:       msg.ClientToolCall.ToolName,
+				Parameters: msg.ClientToolCall.Parameters,
+			}}
+		case protocol.ElevenLabsPing:
+			if err := s.write(protocol.NewPong(msg.Ping.EventID)); err != nil {
+				fmt.Printf("Error answering ElevenLabs ping: %v\n", err)
+			}
+			continue
+		default:
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Scripted is a local agent that plays back a fixed list of events. It is
+// used in tests and for demos without an ElevenLabs account.
+type Scripted struct {
+	Script []Event
+
+	mu       sync.Mutex
+	sessions []*ScriptedSession
+	counter  int
+}
+
+func NewScripted(script ...Event) *Scripted {
+	return &Scripted{Script: script}
+}
+
+func (a *Scripted) Start(ctx context.Context, params StartParams) (Session, error) {
+	a.mu.Lock()
+	a.counter++
+	s := &ScriptedSession{
+		Params:         params,
+		conversationID: fmt.Sprintf("scripted_%d", a.counter),
+		events:         make(chan Event, len(a.Script)+1),
+		done:           make(chan struct{}),
+	}
+	a.sessions = append(a.sessions, s)
+	a.mu.Unlock()
+
+	s.events <- Event{Type: EventStarted, ConversationID: s.conversationID}
+	for _, event := range a.Script {
+		s.events <- event
+	}
+
+	return s, nil
+}
+
+// Sessions returns every conversation started so far.
+func (a *Scripted) Sessions() []*ScriptedSession {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]*ScriptedSession(nil), a.sessions...)
+}
+
+type ScriptedSession struct {
+	Params StartParams
+
+	conversationID string
+	events         chan Event
+	done           chan struct{}
+	endOnce        sync.Once
+
+	mu          sync.Mutex
+	audio       []string
+	toolResults []ToolResult
+}
+
+// ToolResult is a tool call answer received by a scripted session.
+type ToolResult struct {
+	CallID  string
+	Result  string
+	IsError bool
+}
+
+func (s *ScriptedSession) Events() <-chan Event {
+	return s.events
+}
+
+func (s *ScriptedSession) SendAudio(payload string) error {
+	select {
+	case <-s.done:
+		return fmt.Errorf("conversation %s has ended", s.conversationID)
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audio = append(s.audio, payload)
+	return nil
+}
+
+func (s *ScriptedSession) SendToolResult(callID, result string, isError bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.toolResults = append(s.toolResults, ToolResult{CallID: callID, Result: result, IsError: isError})
+	return nil
+}
+
+func (s *ScriptedSession) End() error {
+	s.endOnce.Do(func() {
+		close(s.done)
+		close(s.events)
+	})
+	return nil
+}
+
+func (s *ScriptedSession) ConversationID() string {
+	return s.conversationID
+}
+
+// ReceivedAudio returns the caller audio chunks sent to the agent.
+func (s *ScriptedSession) ReceivedAudio() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.audio...)
+}
+
+// ToolResults returns the tool call answers sent to the agent.
+func (s *ScriptedSession) ToolResults() []ToolResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ToolResult(nil), s.toolResults...)
+}
+
+// Ended reports whether End has been called.
+func (s *ScriptedSession) Ended() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,12 +1,15 @@
 package ai
 
-import "fmt"
+import (
+	"fmt"
+
+	"claimsio/internal/money"
+)
 
 func GenerateInboundCallPrompt(
 	name string,
 	caseNumber string,
-	debtAmount int64,
-	currency string,
+	debt money.Money,
 	phone string,
 	prevMessages string,
 ) (string, error) {
@@ -18,12 +21,10 @@ Your role requires you to think carefully through each situation, understand con
 Context about the caller:
 Name: %s
 Case Number: %s
-Debt Amount: %v %s
+Debt Amount: %s
 Caller Phone: %s
 Previous Messages: %s
 
-Important: Please have in mind that All monetary values are stored as integers representing the smallest currency unit (e.g., 1000 represents 10.00 PLN).
-
 Your role is to:
 1. Help callers understand their case details
 2. Provide clear explanations about payment options
@@ -35,5 +36,5 @@ Please avoid:
 - Sharing sensitive information without verification
 - Being confrontational or aggressive`
 
-	return fmt.Sprintf(prompt, name, caseNumber, debtAmount, currency, phone, prevMessages), nil
+	return fmt.Sprintf(prompt, name, caseNumber, debt, phone, prevMessages), nil
 }
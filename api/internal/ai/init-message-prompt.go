@@ -1,12 +1,15 @@
 package ai
 
-import "fmt"
+import (
+	"fmt"
+
+	"claimsio/internal/money"
+)
 
 func GenerateInitMessagePrompt(
 	name string,
 	caseNumber string,
-	debtAmount int64,
-	currency string,
+	debt money.Money,
 	phone string,
 	language string,
 	description string,
@@ -24,14 +27,12 @@ Context about the caller:
 Name: %s
 Language: %s
 Case Number: %s
-Debt Amount: %v %s
+Debt Amount: %s
 Caller Phone: %s
 Description: %s
 
 Generate message in language of the debtor using above context.
 
-Important: Please have in mind that All monetary values are stored as integers representing the smallest currency unit (e.g., 1000 represents 10.00 PLN).
-
 Please avoid:
 - Making promises about debt forgiveness
 - Sharing sensitive information without verification
@@ -42,8 +43,7 @@ Please avoid:
 		name,
 		language,
 		caseNumber,
-		debtAmount,
-		currency,
+		debt.Format(language),
 		phone,
 		description,
 	), nil
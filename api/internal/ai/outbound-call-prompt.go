@@ -1,12 +1,16 @@
 package ai
 
-import "fmt"
+import (
+	"fmt"
+
+	"claimsio/internal/money"
+)
 
 func GenerateOutboundCallPrompt(
 	name string,
+	language string,
 	caseNumber string,
-	debtAmount int64,
-	currency string,
+	debt money.Money,
 	phone string,
 	prevMessages string,
 ) (string, error) {
@@ -16,11 +20,11 @@ You are an AI Debt Collection Agent specializing in professional and compliant d
 Your role requires you to think carefully through each situation, understand context deeply, and make well-reasoned decisions about communication approaches.
 
 Context about the person you're calling:
-Name: %s %s
+Name: %s
+Language: %s
 Case Number: %s
-Debt Amount: %v %s
+Debt Amount: %s
 Caller Phone: %s
-Case Description: %s
 Previous Messages: %s
 
 Your objectives are to:
@@ -35,5 +39,5 @@ Guidelines:
 - Document any agreements or promises made
 - Follow up on any unresolved matters`
 
-	return fmt.Sprintf(prompt, name, caseNumber, debtAmount, currency, phone, prevMessages), nil
+	return fmt.Sprintf(prompt, name, language, caseNumber, debt.Format(language), phone, prevMessages), nil
 }
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+
+	"claimsio/internal/agent"
+	"claimsio/internal/protocol"
+	"claimsio/internal/recording"
+	"claimsio/internal/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// mediaBridge connects a Twilio media stream with an agent conversation.
+// Gorilla websockets allow only one concurrent writer, so every write to the
+// Twilio socket goes through the bridge.
+type mediaBridge struct {
+	twilioConn   *websocket.Conn
+	conversation agent.Session
+	streamSid    string
+
+	twilioMu sync.Mutex
+
+	// optional, records both sides of the call
+	recorder *recording.Recorder
+
+	// called once the agent reports the conversation id
+	onConversationID func(conversationID string)
+	// called for every transcribed agent or caller utterance
+	onTranscript func(speaker, text string)
+	// answers client tool calls, an error is reported back to the agent
+	onToolCall func(call agent.ToolCall) (string, error)
+}
+
+func newMediaBridge(twilioConn *websocket.Conn, conversation agent.Session, streamSid string) *mediaBridge {
+	return &mediaBridge{
+		twilioConn:   twilioConn,
+		conversation: conversation,
+		streamSid:    streamSid,
+	}
+}
+
+func (b *mediaBridge) sendToTwilio(v interface{}) error {
+	b.twilioMu.Lock()
+	defer b.twilioMu.Unlock()
+	return b.twilioConn.WriteJSON(v)
+}
+
+// forwardUserAudio sends a base64 μ-law chunk from Twilio to the agent.
+func (b *mediaBridge) forwardUserAudio(payload string) error {
+	if b.recorder != nil {
+		if err := b.recorder.AddCaller(payload); err != nil {
+			fmt.Printf("Error recording caller audio: %v\n", err)
+		}
+	}
+	return b.conversation.SendAudio(payload)
+}
+
+// hangup ends the agent conversation. It is safe to call more than once.
+func (b *mediaBridge) hangup() {
+	b.conversation.End()
+}
+
+// run relays agent events until the conversation ends, routing agent audio
+// and interruptions to Twilio.
+func (b *mediaBridge) run() {
+	for event := range b.conversation.Events() {
+		switch event.Type {
+		case agent.EventAudio:
+			if b.recorder != nil {
+				if err := b.recorder.AddAgent(event.Audio); err != nil {
+					fmt.Printf("Error recording agent audio: %v\n", err)
+				}
+			}
+			if err := b.sendToTwilio(protocol.NewTwilioMedia(b.streamSid, event.Audio)); err != nil {
+				fmt.Printf("Error forwarding audio to Twilio: %v\n", err)
+			}
+
+		case agent.EventStarted:
+			if b.onConversationID != nil {
+				b.onConversationID(event.ConversationID)
+			}
+
+		case agent.EventInterruption:
+			if b.recorder != nil {
+				b.recorder.Interrupt()
+			}
+			if err := b.sendToTwilio(protocol.NewTwilioClear(b.streamSid)); err != nil {
+				fmt.Printf("Error clearing Twilio audio: %v\n", err)
+			}
+
+		case agent.EventAgentResponse:
+			if b.onTranscript != nil {
+				b.onTranscript(session.SpeakerAgent, event.Text)
+			}
+
+		case agent.EventUserTranscript:
+			if b.onTranscript != nil {
+				b.onTranscript(session.SpeakerUser, event.Text)
+			}
+
+		case agent.EventToolCall:
+			b.answerToolCall(*event.ToolCall)
+		}
+	}
+}
+
+func (b *mediaBridge) answerToolCall(call agent.ToolCall) {
+	result, err := "", fmt.Errorf("unknown tool %q", call.Name)
+	if b.onToolCall != nil {
+		result, err = b.onToolCall(call)
+	}
+	if err != nil {
+		fmt.Printf("Tool call %s failed: %v\n", call.Name, err)
+		result = err.Error()
+	}
+	if err := b.conversation.SendToolResult(call.ID, result, err != nil); err != nil {
+		fmt.Printf("Error answering tool call %s: %v\n", call.Name, err)
+	}
+}
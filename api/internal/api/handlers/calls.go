@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"claimsio/internal/session"
+	"claimsio/internal/store"
+)
+
+// HandleListActiveCalls returns the calls currently in progress.
+func HandleListActiveCalls(sessions *session.Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, struct {
+			Calls []session.Snapshot `json:"calls"`
+		}{
+			Calls: sessions.Active(),
+		})
+	})
+}
+
+// HandleGetCallTranscript returns the turn-by-turn transcript of a call,
+// live for calls in progress and from the store once they have ended.
+func HandleGetCallTranscript(svc *CallServices) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callSid := r.PathValue("callSid")
+
+		var turns []store.TranscriptTurn
+		if sess, ok := svc.Sessions.Get(callSid); ok && sess.CallSid() == callSid {
+			turns = toStoreTranscript(sess.Transcript())
+		} else {
+			if _, err := svc.Store.GetCall(r.Context(), callSid); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					writeErrorResponse(w, http.StatusNotFound, "call not found", err)
+					return
+				}
+				writeErrorResponse(w, http.StatusInternalServerError, "failed to load call", err)
+				return
+			}
+
+			var err error
+			turns, err = svc.Store.GetTranscript(r.Context(), callSid)
+			if err != nil {
+				writeErrorResponse(w, http.StatusInternalServerError, "failed to load transcript", err)
+				return
+			}
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			CallSid string                 `json:"call_sid"`
+			Turns   []store.TranscriptTurn `json:"turns"`
+		}{
+			CallSid: callSid,
+			Turns:   turns,
+		})
+	})
+}
+
+func toStoreTranscript(turns []session.Turn) []store.TranscriptTurn {
+	converted := make([]store.TranscriptTurn, 0, len(turns))
+	for _, turn := range turns {
+		converted = append(converted, store.TranscriptTurn{
+			Speaker:   turn.Speaker,
+			Text:      turn.Text,
+			Timestamp: turn.Timestamp,
+		})
+	}
+	return converted
+}
@@ -2,150 +2,127 @@ package handlers
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
-
-	"github.com/gorilla/websocket"
+	"strconv"
+	"strings"
+	"time"
+
+	"claimsio/internal/agent"
+	"claimsio/internal/compliance"
+	"claimsio/internal/config"
+	"claimsio/internal/debtor"
+	"claimsio/internal/money"
+	"claimsio/internal/n8n"
+	"claimsio/internal/recording"
+	"claimsio/internal/session"
+	"claimsio/internal/store"
 )
 
-type ElevenLabsConfig struct {
-	Type                       string `json:"type"`
-	ConversationConfigOverride struct {
-		Agent struct {
-			Prompt struct {
-				Prompt string `json:"prompt"`
-			} `json:"prompt"`
-			FirstMessage string `json:"first_message"`
-		} `json:"agent"`
-	} `json:"conversation_config_override"`
-	ClientData struct {
-		DynamicVariables map[string]string `json:"dynamic_variables,omitempty"`
-	} `json:"client_data,omitempty"`
+// CallServices are the dependencies shared by the media stream handlers.
+type CallServices struct {
+	Sessions   *session.Manager
+	Agent      agent.Conversational
+	Store      store.Store
+	Recordings recording.BlobStore
+	N8N        *n8n.Client
+	Debtors    debtor.Resolver
+	Compliance *compliance.Engine
 }
 
-func initializeElevenLabs(
-	params map[string]interface{},
-	userData map[string]interface{},
-	agentID string,
-	apiKey string,
-	streamSid string,
-) (*websocket.Conn, error) {
-	signedURL, err := getElevenLabsSignedURL(agentID, apiKey)
-	if err != nil {
-		return nil, err
+// OptOutTool is the client tool the agent calls when the debtor asks not to
+// be contacted again. It takes a channel ("call", "sms" or "all") and the
+// reason in the debtor's words.
+const OptOutTool = "opt_out"
+
+// PaymentPlanTool is the client tool the agent calls to look up the
+// installments the debtor has agreed to. It takes no parameters.
+const PaymentPlanTool = "payment_plan"
+
+// handleToolCall answers the client tools the agent may use during a call.
+func handleToolCall(ctx context.Context, svc *CallServices, sess *session.CallSession, call agent.ToolCall) (string, error) {
+	switch call.Name {
+	case OptOutTool:
+		return handleOptOutTool(ctx, svc, sess, call)
+	case PaymentPlanTool:
+		return handlePaymentPlanTool(ctx, svc, sess)
+	default:
+		return "", fmt.Errorf("unknown tool %q", call.Name)
 	}
+}
 
-	ws, _, err := websocket.DefaultDialer.Dial(signedURL, nil)
-	if err != nil {
-		return nil, err
+func handleOptOutTool(ctx context.Context, svc *CallServices, sess *session.CallSession, call agent.ToolCall) (string, error) {
+	name, _ := call.Parameters["channel"].(string)
+	channels, ok := compliance.ParseChannels(name)
+	if !ok {
+		return "", fmt.Errorf("unknown channel %q", name)
 	}
+	reason, _ := call.Parameters["reason"].(string)
 
-	config := createElevenLabsConfig(params, userData)
-
-	if err := ws.WriteJSON(config); err != nil {
-		ws.Close()
-		return nil, err
+	phone := sess.Snapshot().Phone
+	for _, channel := range channels {
+		if err := svc.Compliance.OptOut(ctx, phone, channel, reason, compliance.SourceAgent); err != nil {
+			return "", fmt.Errorf("failed to register opt-out: %w", err)
+		}
 	}
 
-	// Handle ElevenLabs messages in a separate goroutine
-	// go handleElevenLabsMessages(ws)
-	fmt.Println("Handling ElevenLabs messages")
-	// go handleElevenLabsMessages(ws, streamSid)
-	go handleElevenLabsMessages(ws, streamSid)
-
-	return ws, nil
+	return "The debtor will not be contacted again on the requested channels.", nil
 }
 
-func handleElevenLabsMessages(ws *websocket.Conn, streamSid string) {
-	fmt.Println("Handling ElevenLabs messages")
-	fmt.Println("Stream SID: ", streamSid)
-	for {
-		_, message, err := ws.ReadMessage()
-		if err != nil {
-			fmt.Printf("Error reading from ElevenLabs: %v\n", err)
-			return
-		}
-
-		var data map[string]interface{}
-		if err := json.Unmarshal(message, &data); err != nil {
-			fmt.Printf("Error parsing ElevenLabs message: %v\n", err)
-			continue
-		}
+// handlePaymentPlanTool describes the debtor's payment plans to the agent.
+func handlePaymentPlanTool(ctx context.Context, svc *CallServices, sess *session.CallSession) (string, error) {
+	debtorID := sess.Snapshot().DebtorID
+	if debtorID == "" {
+		return "The debtor is not identified, so no payment plan can be found.", nil
+	}
 
-		messageType, ok := data["type"].(string)
-		if !ok {
-			continue
-		}
+	plans, err := svc.Store.ListDebtorPaymentPlans(ctx, debtorID)
+	if err != nil {
+		return "", fmt.Errorf("failed to list payment plans: %w", err)
+	}
+	if len(plans) == 0 {
+		return "The debtor has no payment plan.", nil
+	}
 
-		switch messageType {
-		case "audio":
-			fmt.Println("Audio event received from ElevenLabs")
-			if audioEvent, ok := data["audio_event"].(map[string]interface{}); ok {
-				if audioBase64, ok := audioEvent["audio_base_64"].(string); ok {
-					audioData := map[string]interface{}{
-						"event":     "media",
-						"streamSid": streamSid,
-						"media": map[string]interface{}{
-							"payload": audioBase64,
-						},
-					}
-					if err := ws.WriteJSON(audioData); err != nil {
-						fmt.Printf("Error forwarding audio to Twilio: %v\n", err)
-					} else {
-						fmt.Printf("Successfully forwarded audio chunk to Twilio for stream: %s\n", streamSid)
-					}
-				}
-			}
-
-		case "conversation_initiation_metadata":
-			fmt.Println("Conversation initiation metadata event received from ElevenLabs")
-			if metadata, ok := data["conversation_initiation_metadata_event"].(map[string]interface{}); ok {
-				if conversationID, ok := metadata["conversation_id"].(string); ok {
-					// Store conversation ID
-					if conv, exists := inboundConversations.Load(streamSid); exists {
-						conv.(*InboundConversation).ConversationID = conversationID
-						inboundConversations.Store(streamSid, conv)
-					}
-				}
-			}
-
-		case "interruption":
-			ws.WriteJSON(map[string]interface{}{
-				"event": "clear",
-			})
-
-		case "ping":
-			if pingEvent, ok := data["ping_event"].(map[string]interface{}); ok {
-				if eventID, ok := pingEvent["event_id"].(string); ok {
-					ws.WriteJSON(map[string]interface{}{
-						"type":     "pong",
-						"event_id": eventID,
-					})
-				}
-			}
+	var b strings.Builder
+	for _, plan := range plans {
+		fmt.Fprintf(&b, "Payment plan for case %s, %s in %d installments, %s:\n",
+			plan.CaseID, formatAmount(plan.Amount, plan.Currency), len(plan.Installments), plan.Status)
+		for _, in := range plan.Installments {
+			fmt.Fprintf(&b, "- installment %d: %s due %s, %s\n",
+				in.Number, formatAmount(in.Amount, plan.Currency), in.DueDate.Format(time.DateOnly), in.Status)
 		}
 	}
+	return b.String(), nil
 }
 
-func createElevenLabsConfig(params map[string]interface{}, userData map[string]interface{}) ElevenLabsConfig {
-	config := ElevenLabsConfig{
-		Type: "conversation_initiation_client_data",
+// formatAmount renders a stored amount for the agent, falling back to minor
+// units for currencies the money package does not know.
+func formatAmount(amount int64, currency string) string {
+	m, err := money.New(amount, currency)
+	if err != nil {
+		return fmt.Sprintf("%d %s minor units", amount, strings.ToUpper(currency))
 	}
+	return m.String()
+}
+
+// agentInstructions tell the agent when to use its client tools.
+const agentInstructions = `If the debtor asks not to be called or texted again, call the opt_out tool with the channel they named (call, sms or all) and their reason, then confirm and end the call politely.
+
+If the debtor asks about their payment plan or installments, call the payment_plan tool and tell them what is due next.`
+
+// createAgentParams builds the agent prompt for a call from the media stream
+// parameters and the debtor record.
+func createAgentParams(params map[string]string, userData map[string]interface{}) agent.StartParams {
+	var config agent.StartParams
 
 	if userData != nil {
 		// extract debtor_id from userData
 		debtorID, _ := userData["debtor_id"].(string)
 
-		// extract caller_phone from params
-		callerPhone, _ := params["caller_phone"].(string)
-
-		// get prompt from params if exists
-		prompt := ""
-		if p, ok := params["prompt"].(string); ok {
-			prompt = p
-		}
+		// extract caller_phone and prompt from params
+		callerPhone := params["caller_phone"]
+		prompt := params["prompt"]
 
 		// create base prompt with available information
 		basePrompt := fmt.Sprintf(`You are a customer service representative AI agent.
@@ -157,111 +134,105 @@ Caller Phone: %s`, debtorID, callerPhone)
 			basePrompt = fmt.Sprintf("%s\n\n%s", basePrompt, prompt)
 		}
 
-		config.ConversationConfigOverride.Agent.Prompt.Prompt = basePrompt
-		config.ConversationConfigOverride.Agent.FirstMessage = "Hello, do you have a moment to talk?"
+		config.Prompt = fmt.Sprintf("%s\n\n%s", basePrompt, agentInstructions)
+		config.FirstMessage = "Hello, do you have a moment to talk?"
 
 		// set dynamic variables with available data
-		config.ClientData.DynamicVariables = map[string]string{
+		config.DynamicVariables = map[string]string{
 			"caller_phone": callerPhone,
 			"debtor_id":    debtorID,
 		}
 	} else {
 		// default configuration for unauthorized users
-		config.ConversationConfigOverride.Agent.Prompt.Prompt = "You are a customer service representative"
-		config.ConversationConfigOverride.Agent.FirstMessage = "Hello, do you have a moment to talk?"
+		config.Prompt = "You are a customer service representative"
+		config.FirstMessage = "Hello, do you have a moment to talk?"
 	}
 
 	return config
 }
 
-func sendWebhook(endpoint string, payload map[string]interface{}, authToken string) error {
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("error marshaling webhook payload: %v", err)
-	}
-
-	url := fmt.Sprintf("http://app-n8n-1:5678/webhook/%s", endpoint)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+// recordCallStart stores the call row once the debtor is known. Database
+// errors are logged and never interrupt the call.
+func recordCallStart(ctx context.Context, svc *CallServices, sess *session.CallSession) {
+	call := sess.Snapshot()
+	err := svc.Store.CreateCall(ctx, &store.Call{
+		CallSid:   call.CallSid,
+		Direction: string(call.Direction),
+		StreamSid: call.StreamSid,
+		DebtorID:  call.DebtorID,
+		Phone:     call.Phone,
+		StartedAt: call.CreatedAt,
+	})
 	if err != nil {
-		return fmt.Errorf("error creating webhook request: %v", err)
+		fmt.Printf("Failed to record call %s: %v\n", call.CallSid, err)
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", authToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("error sending webhook: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("webhook failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	return nil
 }
 
-func getElevenLabsSignedURL(agentID string, apiKey string) (string, error) {
-	url := fmt.Sprintf("https://api.elevenlabs.io/v1/convai/conversation/get_signed_url?agent_id=%s",
-		agentID)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
+// shouldRecord decides whether a call is recorded. A "record" stream
+// parameter overrides the RECORD_CALLS default.
+func shouldRecord(cfg *config.Config, params map[string]string) bool {
+	if record, err := strconv.ParseBool(params["record"]); err == nil {
+		return record
 	}
+	return cfg.RecordCalls
+}
 
-	req.Header.Set("xi-api-key", apiKey)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+// saveRecording uploads the call audio as a WAV file and returns its location.
+func saveRecording(ctx context.Context, svc *CallServices, callSid string, recorder *recording.Recorder) (string, error) {
+	var buf bytes.Buffer
+	if err := recorder.WriteWAV(&buf); err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
+	return svc.Recordings.Put(ctx, fmt.Sprintf("calls/%s.wav", callSid), &buf)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get signed URL: %s", resp.Status)
+// finishCall ends the session, stores the outcome and reports it to n8n.
+// Calling it again for the same session is a no-op. recorder may be nil.
+func finishCall(svc *CallServices, sess *session.CallSession, recorder *recording.Recorder, reason string) {
+	call, ok := svc.Sessions.End(sess, reason)
+	if !ok {
+		return
 	}
 
-	var result struct {
-		SignedURL string `json:"signed_url"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
+	ctx := context.Background()
 
-	return result.SignedURL, nil
-}
-
-func checkUserExists(phone string) (map[string]interface{}, error) {
-	payload := map[string]string{"phone": phone}
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
+	var recordingURL string
+	if recorder != nil && !recorder.Empty() {
+		var err error
+		recordingURL, err = saveRecording(ctx, svc, call.CallSid, recorder)
+		if err != nil {
+			fmt.Printf("Failed to save recording of call %s: %v\n", call.CallSid, err)
+		}
 	}
 
-	req, err := http.NewRequest("GET", "http://app-n8n-1:5678/webhook/check-user", bytes.NewBuffer(jsonData))
+	err := svc.Store.FinishCall(ctx, call.CallSid, store.CallEnd{
+		ConversationID: call.ConversationID,
+		Duration:       call.Duration(),
+		EndReason:      call.EndReason,
+		EndedAt:        call.EndedAt,
+		RecordingURL:   recordingURL,
+	})
 	if err != nil {
-		return nil, err
+		fmt.Printf("Failed to record end of call %s: %v\n", call.CallSid, err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
 
-	if err != nil {
-		return nil, err
+	if turns := sess.Transcript(); len(turns) > 0 {
+		if err := svc.Store.SaveTranscript(ctx, call.CallSid, toStoreTranscript(turns)); err != nil {
+			fmt.Printf("Failed to save transcript of call %s: %v\n", call.CallSid, err)
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("user check failed with status: %d", resp.StatusCode)
+	payload := map[string]interface{}{
+		"conversation_id": call.ConversationID,
+		"phone_number":    call.Phone,
+		"call_sid":        call.CallSid,
+		"stream_sid":      call.StreamSid,
+		"end_reason":      call.EndReason,
 	}
 
-	var userData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&userData); err != nil {
-		return nil, err
+	// undelivered outcomes stay in the n8n outbox and are redelivered later
+	endpoint := fmt.Sprintf("%s-calls", call.Direction)
+	if err := svc.N8N.Notify(ctx, endpoint, payload); err != nil {
+		fmt.Printf("Failed to send %s webhook for call %s: %v\n", endpoint, call.CallSid, err)
 	}
-
-	return userData, nil
 }
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"claimsio/internal/compliance"
+)
+
+// allowContact asks the compliance engine whether number may be contacted
+// on channel now. When it may not, the refusal is written for n8n and false
+// is returned.
+func allowContact(w http.ResponseWriter, r *http.Request, engine *compliance.Engine, number string, channel compliance.Channel, timezone string) bool {
+	err := engine.Check(r.Context(), number, channel, timezone)
+	if err == nil {
+		return true
+	}
+
+	var refusal *compliance.Refusal
+	switch {
+	case errors.As(err, &refusal):
+		// kept in the logs as the audit trail of blocked contacts
+		fmt.Printf("Blocked %s to %s: %s (%s)\n", channel, number, refusal.Reason, refusal.Code)
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"success": false,
+			"message": refusal.Reason,
+			"refusal": refusal,
+		})
+	case errors.Is(err, compliance.ErrInvalidTimezone):
+		writeErrorResponse(w, http.StatusBadRequest, "invalid timezone", err)
+	default:
+		writeErrorResponse(w, http.StatusInternalServerError, "failed to check contact rules", err)
+	}
+	return false
+}
+
+// recordContact adds a placed call or SMS to the contact history. Errors are
+// logged, the contact already happened.
+func recordContact(r *http.Request, engine *compliance.Engine, number string, channel compliance.Channel, reference string) {
+	if err := engine.Record(r.Context(), number, channel, reference); err != nil {
+		fmt.Printf("Failed to record %s contact with %s: %v\n", channel, number, err)
+	}
+}
@@ -1,28 +1,24 @@
 package handlers
 
 import (
+	"claimsio/internal/agent"
 	"claimsio/internal/config"
+	"claimsio/internal/debtor"
+	"claimsio/internal/phone"
+	"claimsio/internal/protocol"
+	"claimsio/internal/recording"
+	"claimsio/internal/session"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"sync"
 
 	"github.com/gorilla/websocket"
 )
 
-// TODO - test this
-
-type InboundConversation struct {
-	StreamSid      string
-	ConversationID string
-	CallerPhone    string
-	UserData       map[string]interface{}
-}
-
-var inboundConversations sync.Map
-
-func HandleInboundCall(cfg *config.Config, upgrader websocket.Upgrader) http.Handler {
+func HandleInboundCall(cfg *config.Config, svc *CallServices) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			if err := r.ParseForm(); err != nil {
@@ -30,11 +26,18 @@ func HandleInboundCall(cfg *config.Config, upgrader websocket.Upgrader) http.Han
 				return
 			}
 
-			callerPhone := r.FormValue("From")
-			fmt.Printf("Incoming call received from: %s\n", callerPhone)
+			fmt.Printf("Incoming call received from: %s\n", r.FormValue("From"))
 
-			// Check user authorization
-			userData, err := checkUserExists(callerPhone)
+			// Check user authorization, withheld and invalid numbers are
+			// turned away like unknown ones
+			callerPhone, err := phone.Normalize(r.FormValue("From"))
+			var userData debtor.Record
+			if err == nil {
+				userData, err = svc.Debtors.Resolve(r.Context(), callerPhone)
+			}
+			if err != nil && !errors.Is(err, debtor.ErrNotFound) {
+				fmt.Printf("Failed to resolve debtor for %s: %v\n", r.FormValue("From"), err)
+			}
 			if err != nil || userData == nil {
 				twiml := `<?xml version="1.0" encoding="UTF-8"?>
             <Response>
@@ -63,7 +66,7 @@ func HandleInboundCall(cfg *config.Config, upgrader websocket.Upgrader) http.Han
 		})
 }
 
-func HandleInboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader) http.Handler {
+func HandleInboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader, svc *CallServices) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("Upgrading connection")
 		conn, err := upgrader.Upgrade(w, r, nil)
@@ -75,8 +78,21 @@ func HandleInboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader) h
 		defer conn.Close()
 
 		var streamSid string
-		var elevenLabsWs *websocket.Conn
+		var bridge *mediaBridge
+		var sess *session.CallSession
+		var recorder *recording.Recorder
 		isDisconnecting := false
+
+		// make sure the session is released however the stream ends
+		defer func() {
+			if bridge != nil {
+				bridge.hangup()
+			}
+			if sess != nil {
+				finishCall(svc, sess, recorder, session.EndReasonDisconnected)
+			}
+		}()
+
 		// Handle incoming messages
 		for {
 			messageType, message, err := conn.ReadMessage()
@@ -88,34 +104,29 @@ func HandleInboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader) h
 				continue
 			}
 
-			var data map[string]interface{}
-			if err := json.Unmarshal(message, &data); err != nil {
+			msg, err := protocol.DecodeTwilio(message)
+			if err != nil {
 				fmt.Printf("Error parsing message: %v\n", err)
 				continue
 			}
 
-			event, ok := data["event"].(string)
-			if !ok {
-				continue
-			}
-
 			// Skip non-stop events if disconnecting
-			if isDisconnecting && event != "stop" {
-				fmt.Printf("Ignoring event during disconnect: %s\n", event)
+			if isDisconnecting && msg.Event != protocol.TwilioEventStop {
+				fmt.Printf("Ignoring event during disconnect: %s\n", msg.Event)
 				continue
 			}
 
-			switch event {
-			case "start":
+			switch msg.Event {
+			case protocol.TwilioEventStart:
+				streamSid = msg.Start.StreamSid
+				params := msg.Start.CustomParameters
+				callerPhone := params["caller_phone"]
 
-				startData := data["start"].(map[string]interface{})
-				streamSid = startData["streamSid"].(string)
-				params := startData["customParameters"].(map[string]interface{})
-				callerPhone := params["caller_phone"].(string)
+				sess = svc.Sessions.Start(session.Inbound, msg.Start.CallSid, streamSid, callerPhone)
 
 				// Parse user data
 				var userData map[string]interface{}
-				if userDataStr, ok := params["user_data"].(string); ok {
+				if userDataStr, ok := params["user_data"]; ok {
 
 					decodedStr, err := url.QueryUnescape(userDataStr)
 					if err != nil {
@@ -130,71 +141,58 @@ func HandleInboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader) h
 						return
 					}
 				}
+				sess.SetUserData(userData)
+				recordCallStart(r.Context(), svc, sess)
 
-				elevenLabsWs, err = initializeElevenLabs(params,
-					userData,
-					cfg.ElevenLabsAgentID,
-					cfg.ElevenLabsAPIKey,
-					streamSid,
-				)
+				conversation, err := svc.Agent.Start(r.Context(), createAgentParams(params, userData))
 				if err != nil {
-					fmt.Printf("Failed to initialize ElevenLabs: %v\n", err)
+					fmt.Printf("Failed to start agent conversation: %v\n", err)
+					finishCall(svc, sess, recorder, session.EndReasonAgentFailed)
 					return
 				}
-				// Store conversation data
-				conv := &InboundConversation{
-					StreamSid:   streamSid,
-					CallerPhone: callerPhone,
-					UserData:    userData,
+				svc.Sessions.Activate(sess)
+
+				bridge = newMediaBridge(conn, conversation, streamSid)
+				bridge.onConversationID = func(conversationID string) {
+					svc.Sessions.SetConversationID(sess, conversationID)
+				}
+				bridge.onTranscript = sess.AddTurn
+				bridge.onToolCall = func(call agent.ToolCall) (string, error) {
+					return handleToolCall(context.Background(), svc, sess, call)
+				}
+				if shouldRecord(cfg, params) {
+					recorder = recording.NewRecorder()
+					bridge.recorder = recorder
 				}
-				inboundConversations.Store(streamSid, conv)
+				go bridge.run()
 
-			case "media":
-				if elevenLabsWs != nil && !isDisconnecting {
-					mediaData := data["media"].(map[string]interface{})
-					payload := mediaData["payload"].(string)
+			case protocol.TwilioEventMedia:
+				if bridge != nil && !isDisconnecting {
+					payload := msg.Media.Payload
 
-					// Forward audio to ElevenLabs
-					msg := map[string]interface{}{
-						"user_audio_chunk": payload,
-					}
-					if err := elevenLabsWs.WriteJSON(msg); err != nil {
-						fmt.Printf("Failed to send audio to ElevenLabs: %v\n", err)
+					// Forward audio to agent
+					if err := bridge.forwardUserAudio(payload); err != nil {
+						fmt.Printf("Failed to send audio to agent: %v\n", err)
 					}
-					// else {
-					// 	fmt.Printf("Successfully sent audio chunk to ElevenLabs for stream: %s\n", streamSid)
-					// }
 				}
 
-			case "stop":
+			case protocol.TwilioEventStop:
 				isDisconnecting = true
-				if elevenLabsWs != nil {
-					elevenLabsWs.WriteJSON(map[string]string{"type": "end_conversation"})
-					elevenLabsWs.Close()
+				if bridge == nil {
+					return
 				}
+				bridge.hangup()
 
 				// Send final webhook
-				if conv, ok := inboundConversations.Load(streamSid); ok {
-					payload := map[string]interface{}{
-						"conversation_id": conv.(*InboundConversation).ConversationID,
-						"phone_number":    conv.(*InboundConversation).CallerPhone,
-						"call_sid":        conv.(*InboundConversation).StreamSid,
-					}
-
-					sendWebhook("inbound-calls", payload, cfg.N8NAuthToken)
-					inboundConversations.Delete(streamSid)
-				}
+				finishCall(svc, sess, recorder, session.EndReasonCompleted)
 
 				// Send disconnect signals
-				conn.WriteJSON(map[string]interface{}{
+				bridge.sendToTwilio(map[string]interface{}{
 					"event":     "mark_done",
 					"streamSid": streamSid,
 				})
-				conn.WriteJSON(map[string]interface{}{
-					"event":     "clear",
-					"streamSid": streamSid,
-				})
-				conn.WriteJSON(map[string]interface{}{
+				bridge.sendToTwilio(protocol.NewTwilioClear(streamSid))
+				bridge.sendToTwilio(map[string]interface{}{
 					"event":     "twiml",
 					"streamSid": streamSid,
 					"twiml":     "<Response><Hangup/></Response>",
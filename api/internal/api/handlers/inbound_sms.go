@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"claimsio/internal/compliance"
+	"claimsio/internal/debtor"
+	"claimsio/internal/phone"
+	"claimsio/internal/store"
+)
+
+// Replies to the SMS keywords. Carriers only confirm STOP and START on their
+// own for US and Canadian numbers, so every opt-out and opt-in is confirmed
+// here.
+const (
+	smsStopReply  = "Claimsio: you will not receive more texts about your case. Reply START to receive them again."
+	smsStartReply = "Claimsio: you will receive texts about your case again. Reply STOP to stop receiving them."
+	smsHelpReply  = "Claimsio: messages about your case. Reply STOP to stop receiving texts, START to receive them again."
+)
+
+// HandleInboundSMS receives SMS replies from debtors. Each message is added
+// to the debtor's thread and forwarded to n8n; STOP, START and HELP are
+// handled here.
+func HandleInboundSMS(svc *CallServices) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		from, err := phone.Normalize(r.FormValue("From"))
+		if err != nil {
+			http.Error(w, "Invalid phone number", http.StatusBadRequest)
+			return
+		}
+		body := r.FormValue("Body")
+		messageSid := r.FormValue("MessageSid")
+
+		var debtorID string
+		userData, err := svc.Debtors.Resolve(r.Context(), from)
+		switch {
+		case err == nil:
+			debtorID, _ = userData["debtor_id"].(string)
+		case !errors.Is(err, debtor.ErrNotFound):
+			fmt.Printf("Failed to resolve debtor for %s: %v\n", from, err)
+		}
+
+		err = svc.Store.SaveMessage(r.Context(), &store.Message{
+			MessageSid: messageSid,
+			Direction:  "inbound",
+			Phone:      from,
+			DebtorID:   debtorID,
+			Body:       body,
+			Status:     store.MessageReceived,
+			CreatedAt:  time.Now().UTC(),
+		})
+		if err != nil {
+			fmt.Printf("Failed to save message %s: %v\n", messageSid, err)
+		}
+
+		var reply string
+		keyword, _ := compliance.ParseKeyword(body)
+		switch keyword {
+		case compliance.KeywordStop:
+			err = svc.Compliance.OptOut(r.Context(), from, compliance.ChannelSMS, body, compliance.SourceSMSKeyword)
+			reply = smsStopReply
+		case compliance.KeywordStart:
+			err = svc.Compliance.OptIn(r.Context(), from, compliance.ChannelSMS)
+			reply = smsStartReply
+		case compliance.KeywordHelp:
+			reply = smsHelpReply
+		}
+		if err != nil {
+			// the message is already stored; Twilio's retry saves nothing
+			// twice and tries the keyword again
+			fmt.Printf("Failed to handle %s from %s: %v\n", keyword, from, err)
+			http.Error(w, "Failed to handle keyword", http.StatusInternalServerError)
+			return
+		}
+
+		payload := map[string]interface{}{
+			"message_sid":  messageSid,
+			"phone_number": from,
+			"debtor_id":    debtorID,
+			"body":         body,
+			"keyword":      keyword,
+		}
+		// answer Twilio right away, undelivered events stay in the outbox
+		go func() {
+			if err := svc.N8N.Send(context.Background(), "incoming-sms", payload); err != nil {
+				fmt.Printf("Failed to send incoming-sms webhook for %s: %v\n", messageSid, err)
+			}
+		}()
+
+		writeMessagingTwiML(w, reply)
+	})
+}
+
+// writeMessagingTwiML answers a Twilio messaging webhook, replying with
+// message unless it is empty.
+func writeMessagingTwiML(w http.ResponseWriter, message string) {
+	twiml := `<?xml version="1.0" encoding="UTF-8"?><Response>`
+	if message != "" {
+		var escaped bytes.Buffer
+		xml.EscapeText(&escaped, []byte(message))
+		twiml += "<Message>" + escaped.String() + "</Message>"
+	}
+	twiml += "</Response>"
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write([]byte(twiml))
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"claimsio/internal/compliance"
+	"claimsio/internal/store"
+)
+
+func postInboundSMS(t *testing.T, handler http.Handler, sid, from, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"MessageSid": {sid}, "From": {from}, "Body": {body}}
+	req := httptest.NewRequest(http.MethodPost, "/incoming-sms", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("inbound sms returned status %d: %s", rr.Code, rr.Body.String())
+	}
+	return rr
+}
+
+func TestInboundSMS(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.n8n.Debtors["+48732145999"] = map[string]interface{}{"debtor_id": "debtor123"}
+	handler := HandleInboundSMS(env.svc)
+	ctx := context.Background()
+
+	rr := postInboundSMS(t, handler, "SM1", "+48 732 145 999", "When can I pay?")
+	if strings.Contains(rr.Body.String(), "<Message>") {
+		t.Errorf("unexpected reply to a regular message: %s", rr.Body.String())
+	}
+
+	waitFor(t, "incoming-sms webhook", func() bool { return len(env.n8n.Webhooks("incoming-sms")) == 1 })
+	payload := env.n8n.Webhooks("incoming-sms")[0].Payload
+	if payload["debtor_id"] != "debtor123" || payload["phone_number"] != "+48732145999" || payload["body"] != "When can I pay?" {
+		t.Errorf("unexpected webhook payload: %v", payload)
+	}
+
+	rr = postInboundSMS(t, handler, "SM2", "+48732145999", "STOP")
+	if !strings.Contains(rr.Body.String(), "<Message>"+smsStopReply+"</Message>") {
+		t.Errorf("STOP not confirmed: %s", rr.Body.String())
+	}
+	if _, err := env.calls.GetOptOut(ctx, "+48732145999", "sms"); err != nil {
+		t.Errorf("opt-out not stored after STOP: %v", err)
+	}
+
+	rr = postInboundSMS(t, handler, "SM3", "+48732145999", "start")
+	if !strings.Contains(rr.Body.String(), "<Message>"+smsStartReply+"</Message>") {
+		t.Errorf("START not confirmed: %s", rr.Body.String())
+	}
+	if _, err := env.calls.GetOptOut(ctx, "+48732145999", "sms"); err != store.ErrNotFound {
+		t.Errorf("opt-out not lifted after START: %v", err)
+	}
+
+	rr = postInboundSMS(t, handler, "SM4", "+48732145999", "HELP")
+	if !strings.Contains(rr.Body.String(), "<Message>Claimsio:") {
+		t.Errorf("HELP not answered: %s", rr.Body.String())
+	}
+	messages, err := env.calls.ListMessages(ctx, "+48732145999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 4 {
+		t.Fatalf("got %d messages in thread, want 4", len(messages))
+	}
+	if m := messages[0]; m.MessageSid != "SM1" || m.Direction != "inbound" || m.DebtorID != "debtor123" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+
+	waitFor(t, "keyword webhooks", func() bool { return len(env.n8n.Webhooks("incoming-sms")) == 4 })
+	for _, hook := range env.n8n.Webhooks("incoming-sms") {
+		if hook.Payload["message_sid"] == "SM2" && hook.Payload["keyword"] != string(compliance.KeywordStop) {
+			t.Errorf("STOP webhook keyword: got %v", hook.Payload["keyword"])
+		}
+	}
+
+	// Twilio redelivers a message it got no answer for
+	postInboundSMS(t, handler, "SM4", "+48732145999", "HELP")
+	messages, err = env.calls.ListMessages(ctx, "+48732145999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 4 {
+		t.Errorf("redelivered message stored again, got %d messages", len(messages))
+	}
+}
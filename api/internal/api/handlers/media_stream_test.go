@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"claimsio/internal/agent"
+	"claimsio/internal/compliance"
+	"claimsio/internal/config"
+	"claimsio/internal/debtor"
+	"claimsio/internal/fake"
+	"claimsio/internal/n8n"
+	"claimsio/internal/protocol"
+	"claimsio/internal/recording"
+	"claimsio/internal/session"
+	"claimsio/internal/store"
+
+	"github.com/gorilla/websocket"
+)
+
+const waitTimeout = 2 * time.Second
+
+type callTestEnv struct {
+	cfg        *config.Config
+	elevenLabs *fake.ElevenLabs
+	n8n        *fake.N8N
+	calls      *store.Memory
+	svc        *CallServices
+}
+
+func newCallTestEnv(t *testing.T) *callTestEnv {
+	t.Helper()
+
+	elevenLabs := fake.NewElevenLabs()
+	t.Cleanup(elevenLabs.Close)
+
+	webhooks := fake.NewN8N()
+	t.Cleanup(webhooks.Close)
+
+	convAgent := agent.NewElevenLabs(elevenLabs.APIKey, "agent_test")
+	convAgent.BaseURL = elevenLabs.URL()
+
+	n8nClient := n8n.New(webhooks.URL(), "n8n_test_token")
+	n8nClient.Backoff = time.Millisecond
+
+	calls := store.NewMemory()
+	recordings := recording.NewLocalStore(t.TempDir())
+
+	return &callTestEnv{
+		cfg: &config.Config{
+			ElevenLabsAPIKey:  elevenLabs.APIKey,
+			ElevenLabsAgentID: "agent_test",
+			N8NAuthToken:      "n8n_test_token",
+		},
+		elevenLabs: elevenLabs,
+		n8n:        webhooks,
+		calls:      calls,
+		svc: &CallServices{
+			Sessions:   session.NewManager(),
+			Agent:      convAgent,
+			Store:      calls,
+			Recordings: recordings,
+			N8N:        n8nClient,
+			Debtors:    debtor.NewN8N(n8nClient),
+			Compliance: compliance.NewEngine(compliance.DefaultRules, calls, calls),
+		},
+	}
+}
+
+func dialStream(t *testing.T, handler http.Handler) *fake.TwilioStream {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	stream, err := fake.DialTwilio("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial media stream: %v", err)
+	}
+	t.Cleanup(func() { stream.Close() })
+
+	return stream
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// assertBridged checks that agent audio reached the caller, the interruption
+// cleared Twilio's buffer, the ping was answered and caller audio reached
+// the agent.
+func assertBridged(t *testing.T, env *callTestEnv, stream *fake.TwilioStream) {
+	t.Helper()
+
+	media, err := stream.WaitForFrames(protocol.TwilioEventMedia, len(env.elevenLabs.AudioChunks), waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, frame := range media {
+		if frame.StreamSid != stream.StreamSid {
+			t.Errorf("media frame %d has stream sid %q, want %q", i, frame.StreamSid, stream.StreamSid)
+		}
+		if frame.Media.Payload != env.elevenLabs.AudioChunks[i] {
+			t.Errorf("media frame %d payload: got %q want %q", i, frame.Media.Payload, env.elevenLabs.AudioChunks[i])
+		}
+	}
+
+	if _, err := stream.WaitForFrames(protocol.TwilioEventClear, 1, waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "pong", func() bool { return len(env.elevenLabs.Pongs()) == 1 })
+	if got := env.elevenLabs.Pongs()[0]; got != env.elevenLabs.PingEventID {
+		t.Errorf("pong event id: got %d want %d", got, env.elevenLabs.PingEventID)
+	}
+
+	if err := stream.SendMedia("Y2FsbGVy"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "caller audio", func() bool { return len(env.elevenLabs.UserAudio()) == 1 })
+	if got := env.elevenLabs.UserAudio()[0]; got != "Y2FsbGVy" {
+		t.Errorf("caller audio: got %q want %q", got, "Y2FsbGVy")
+	}
+}
+
+func TestInboundMediaStream(t *testing.T) {
+	env := newCallTestEnv(t)
+	stream := dialStream(t, HandleInboundMediaStream(env.cfg, websocket.Upgrader{}, env.svc))
+
+	err := stream.Start(map[string]string{
+		"caller_phone": "+48732145999",
+		"user_data":    url.QueryEscape(`{"debtor_id":"debtor123"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertBridged(t, env, stream)
+
+	initiations := env.elevenLabs.Initiations()
+	if len(initiations) != 1 {
+		t.Fatalf("got %d conversations, want 1", len(initiations))
+	}
+	if vars := initiations[0].ClientData.DynamicVariables; vars["debtor_id"] != "debtor123" || vars["caller_phone"] != "+48732145999" {
+		t.Errorf("unexpected dynamic variables: %v", vars)
+	}
+
+	waitFor(t, "conversation id", func() bool {
+		sess, ok := env.svc.Sessions.Get(env.elevenLabs.ConversationID)
+		return ok && sess.CallSid() == stream.CallSid
+	})
+
+	if err := stream.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.WaitClosed(waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks := env.n8n.Webhooks("inbound-calls")
+	if len(hooks) != 1 {
+		t.Fatalf("got %d inbound-calls webhooks, want 1", len(hooks))
+	}
+	payload := hooks[0].Payload
+	if payload["call_sid"] != stream.CallSid || payload["conversation_id"] != env.elevenLabs.ConversationID {
+		t.Errorf("unexpected webhook payload: %v", payload)
+	}
+	if payload["end_reason"] != session.EndReasonCompleted {
+		t.Errorf("end reason: got %v want %s", payload["end_reason"], session.EndReasonCompleted)
+	}
+	if hooks[0].Authorization != env.cfg.N8NAuthToken {
+		t.Errorf("webhook authorization: got %q want %q", hooks[0].Authorization, env.cfg.N8NAuthToken)
+	}
+
+	waitFor(t, "end_conversation", func() bool { return env.elevenLabs.Ended() == 1 })
+	if len(env.svc.Sessions.Active()) != 0 {
+		t.Error("session still active after stop")
+	}
+
+	call, err := env.calls.GetCall(context.Background(), stream.CallSid)
+	if err != nil {
+		t.Fatalf("call record not stored: %v", err)
+	}
+	if call.Direction != "inbound" || call.DebtorID != "debtor123" || call.StreamSid != stream.StreamSid {
+		t.Errorf("unexpected call record: %+v", call)
+	}
+	if call.ConversationID != env.elevenLabs.ConversationID || call.EndReason != session.EndReasonCompleted || call.EndedAt == nil {
+		t.Errorf("call record not finished: %+v", call)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /calls/{callSid}/transcript", HandleGetCallTranscript(env.svc))
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/calls/"+stream.CallSid+"/transcript", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("transcript returned status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var transcript struct {
+		CallSid string                 `json:"call_sid"`
+		Turns   []store.TranscriptTurn `json:"turns"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &transcript); err != nil {
+		t.Fatalf("failed to decode transcript: %v", err)
+	}
+	want := []store.TranscriptTurn{
+		{Speaker: session.SpeakerAgent, Text: env.elevenLabs.AgentResponse},
+		{Speaker: session.SpeakerUser, Text: env.elevenLabs.UserTranscript},
+	}
+	if len(transcript.Turns) != len(want) {
+		t.Fatalf("got %d transcript turns, want %d", len(transcript.Turns), len(want))
+	}
+	for i, turn := range transcript.Turns {
+		if turn.Speaker != want[i].Speaker || turn.Text != want[i].Text || turn.Timestamp.IsZero() {
+			t.Errorf("turn %d: got %+v want %+v", i, turn, want[i])
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/calls/CAunknown/transcript", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("unknown call returned status %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestOutboundMediaStream(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.n8n.Debtors["+48732145999"] = map[string]interface{}{"debtor_id": "debtor456"}
+
+	stream := dialStream(t, HandleOutboundMediaStream(env.cfg, websocket.Upgrader{}, env.svc))
+
+	if err := stream.Start(map[string]string{"number": "+48732145999", "prompt": "Remind about the debt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertBridged(t, env, stream)
+
+	waitFor(t, "conversation id", func() bool {
+		sess, ok := env.svc.Sessions.Get(env.elevenLabs.ConversationID)
+		return ok && sess.Snapshot().DebtorID == "debtor456"
+	})
+
+	if err := stream.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.WaitClosed(waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	hooks := env.n8n.Webhooks("outbound-calls")
+	if len(hooks) != 1 {
+		t.Fatalf("got %d outbound-calls webhooks, want 1", len(hooks))
+	}
+	if got := hooks[0].Payload["conversation_id"]; got != env.elevenLabs.ConversationID {
+		t.Errorf("conversation id: got %v want %s", got, env.elevenLabs.ConversationID)
+	}
+}
+
+// twimlParameters returns the stream parameters of a TwiML response as
+// Twilio decodes them.
+func twimlParameters(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+
+	var twiml struct {
+		Parameters []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"Connect>Stream>Parameter"`
+	}
+	if err := xml.Unmarshal(body, &twiml); err != nil {
+		t.Fatalf("invalid TwiML: %v", err)
+	}
+
+	params := make(map[string]string)
+	for _, p := range twiml.Parameters {
+		params[p.Name] = p.Value
+	}
+	return params
+}
+
+func TestOutboundMediaStreamFromTwiml(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.n8n.Debtors["+48732145999"] = map[string]interface{}{"debtor_id": "debtor456"}
+
+	// the TwiML url is built like createTwilioCall builds it
+	query := url.Values{"prompt": {"Remind about the <overdue> debt & fees"}, "number": {"+48732145999"}, "record": {""}}
+	rr := httptest.NewRecorder()
+	HandleOutboundCallTwiml(env.cfg).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/outbound-call-twiml?"+query.Encode(), nil))
+
+	params := twimlParameters(t, rr.Body.Bytes())
+	if params["number"] != "+48732145999" {
+		t.Errorf("number parameter = %q", params["number"])
+	}
+
+	stream := dialStream(t, HandleOutboundMediaStream(env.cfg, websocket.Upgrader{}, env.svc))
+	if err := stream.Start(params); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "debtor", func() bool {
+		sess, ok := env.svc.Sessions.Get(env.elevenLabs.ConversationID)
+		return ok && sess.Snapshot().DebtorID == "debtor456"
+	})
+	initiations := env.elevenLabs.Initiations()
+	if len(initiations) != 1 {
+		t.Fatalf("got %d conversations, want 1", len(initiations))
+	}
+	if prompt := initiations[0].ConversationConfigOverride.Agent.Prompt.Prompt; !strings.Contains(prompt, "Remind about the <overdue> debt & fees") {
+		t.Errorf("prompt not passed to the agent: %q", prompt)
+	}
+}
+
+func TestMediaStreamOptOutTool(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.n8n.Debtors["+48732145999"] = map[string]interface{}{"debtor_id": "debtor456"}
+	env.elevenLabs.ToolCalls = []protocol.ClientToolCall{{
+		ToolName:   OptOutTool,
+		ToolCallID: "tool_1",
+		Parameters: map[string]interface{}{"channel": "call", "reason": "please stop calling me"},
+	}}
+
+	stream := dialStream(t, HandleOutboundMediaStream(env.cfg, websocket.Upgrader{}, env.svc))
+	if err := stream.Start(map[string]string{"number": "+48732145999"}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "tool result", func() bool { return len(env.elevenLabs.ToolResults()) == 1 })
+	if result := env.elevenLabs.ToolResults()[0]; result.ToolCallID != "tool_1" || result.IsError {
+		t.Errorf("unexpected tool result: %+v", result)
+	}
+
+	optOut, err := env.calls.GetOptOut(context.Background(), "+48732145999", "call")
+	if err != nil {
+		t.Fatalf("opt-out not stored: %v", err)
+	}
+	if optOut.Source != compliance.SourceAgent || optOut.Reason != "please stop calling me" {
+		t.Errorf("unexpected opt-out: %+v", optOut)
+	}
+	if _, err := env.calls.GetOptOut(context.Background(), "+48732145999", "sms"); err != store.ErrNotFound {
+		t.Errorf("sms opt-out: got %v want ErrNotFound", err)
+	}
+}
+
+func TestMediaStreamCleanupOnDisconnect(t *testing.T) {
+	env := newCallTestEnv(t)
+	stream := dialStream(t, HandleInboundMediaStream(env.cfg, websocket.Upgrader{}, env.svc))
+
+	if err := stream.Start(map[string]string{"caller_phone": "+48732145999"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.WaitForFrames(protocol.TwilioEventMedia, 1, waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// drop the socket without a stop event
+	stream.Close()
+
+	waitFor(t, "session cleanup", func() bool { return len(env.svc.Sessions.Active()) == 0 })
+	waitFor(t, "webhook", func() bool { return len(env.n8n.Webhooks("inbound-calls")) == 1 })
+
+	if got := env.n8n.Webhooks("inbound-calls")[0].Payload["end_reason"]; got != session.EndReasonDisconnected {
+		t.Errorf("end reason: got %v want %s", got, session.EndReasonDisconnected)
+	}
+}
+
+func TestMediaStreamRecording(t *testing.T) {
+	env := newCallTestEnv(t)
+	stream := dialStream(t, HandleInboundMediaStream(env.cfg, websocket.Upgrader{}, env.svc))
+
+	if err := stream.Start(map[string]string{"caller_phone": "+48732145999", "record": "true"}); err != nil {
+		t.Fatal(err)
+	}
+	assertBridged(t, env, stream)
+
+	if err := stream.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.WaitClosed(waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	call, err := env.calls.GetCall(context.Background(), stream.CallSid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if call.RecordingURL == "" {
+		t.Fatal("recording was not stored")
+	}
+
+	data, err := os.ReadFile(call.RecordingURL)
+	if err != nil {
+		t.Fatalf("failed to read recording: %v", err)
+	}
+	if len(data) <= 44 || string(data[:4]) != "RIFF" {
+		t.Errorf("recording is not a WAV file with audio (%d bytes)", len(data))
+	}
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"bytes"
+	"claimsio/internal/agent"
+	"claimsio/internal/compliance"
 	"claimsio/internal/config"
+	"claimsio/internal/phone"
+	"claimsio/internal/protocol"
+	"claimsio/internal/recording"
+	"claimsio/internal/session"
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"net/http"
 	"net/url"
-	"sync"
+	"strconv"
 
 	"github.com/gorilla/websocket"
 	"github.com/twilio/twilio-go"
@@ -17,22 +26,15 @@ import (
 	"go.uber.org/zap"
 )
 
-// TODO - test this
-
-type OutboundConversation struct {
-	CallSid        string
-	ConversationID string
-	Number         string
-	UserData       map[string]interface{}
-}
-
-var outboundConversations sync.Map
-
-func HandleOutboundCall(cfg *config.Config) http.Handler {
+func HandleOutboundCall(cfg *config.Config, contacts *compliance.Engine) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
 			Number string `json:"number"`
 			Prompt string `json:"prompt"`
+			// overrides RECORD_CALLS for this call when set
+			Record *bool `json:"record,omitempty"`
+			// debtor's IANA timezone for contact hours, the country's when empty
+			Timezone string `json:"timezone,omitempty"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -45,13 +47,31 @@ func HandleOutboundCall(cfg *config.Config) http.Handler {
 			return
 		}
 
+		number, err := phone.Normalize(req.Number)
+		if err != nil {
+			http.Error(w, "Invalid phone number", http.StatusBadRequest)
+			return
+		}
+
+		// held until the call is recorded, so concurrent requests cannot all
+		// pass the caps
+		defer contacts.Lock(number, compliance.ChannelCall)()
+		if !allowContact(w, r, contacts, number, compliance.ChannelCall, req.Timezone) {
+			return
+		}
+
 		// Create Twilio call
-		call, err := createTwilioCall(req.Number, req.Prompt, r.Host, cfg.TwilioPhoneNumber)
+		record := ""
+		if req.Record != nil {
+			record = strconv.FormatBool(*req.Record)
+		}
+		call, err := createTwilioCall(number, req.Prompt, record, r.Host, cfg.TwilioPhoneNumber)
 		if err != nil {
 			zap.L().Error("Failed to create Twilio call", zap.Error(err))
 			http.Error(w, "Failed to initiate call", http.StatusInternalServerError)
 			return
 		}
+		recordContact(r, contacts, number, compliance.ChannelCall, *call.Sid)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -66,6 +86,7 @@ func HandleOutboundCallTwiml(cfg *config.Config) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		prompt := r.URL.Query().Get("prompt")
 		number := r.URL.Query().Get("number")
+		record := r.URL.Query().Get("record")
 
 		twiml := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
         <Response>
@@ -73,15 +94,24 @@ func HandleOutboundCallTwiml(cfg *config.Config) http.Handler {
                 <Stream url="wss://%s/outbound-media-stream">
                     <Parameter name="prompt" value="%s" />
                     <Parameter name="number" value="%s" />
+                    <Parameter name="record" value="%s" />
                 </Stream>
             </Connect>
-        </Response>`, r.Host, url.QueryEscape(prompt), url.QueryEscape(number))
+        </Response>`, r.Host, xmlEscape(prompt), xmlEscape(number), xmlEscape(record))
 
 		w.Header().Set("Content-Type", "text/xml")
 		w.Write([]byte(twiml))
 	})
 }
 
+// xmlEscape makes s safe for a TwiML attribute. Twilio passes stream
+// parameters on exactly as they are decoded from the XML.
+func xmlEscape(s string) string {
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
+
 // from docs - can be improved
 // router.POST("/answer", func(context *gin.Context) {
 // 	say := &twiml.VoiceSay{
@@ -97,7 +127,7 @@ func HandleOutboundCallTwiml(cfg *config.Config) http.Handler {
 // 	}
 // })
 
-func HandleOutboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader) http.Handler {
+func HandleOutboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader, svc *CallServices) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
@@ -109,11 +139,21 @@ func HandleOutboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader)
 		zap.L().Info("New outbound WebSocket connection established")
 
 		var streamSid string
-		var callSid string
-		var elevenLabsWs *websocket.Conn
-		var customParameters map[string]interface{}
+		var bridge *mediaBridge
+		var sess *session.CallSession
+		var recorder *recording.Recorder
 		isDisconnecting := false
 
+		// make sure the session is released however the stream ends
+		defer func() {
+			if bridge != nil {
+				bridge.hangup()
+			}
+			if sess != nil {
+				finishCall(svc, sess, recorder, session.EndReasonDisconnected)
+			}
+		}()
+
 		for {
 			messageType, message, err := conn.ReadMessage()
 			if err != nil {
@@ -125,92 +165,81 @@ func HandleOutboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader)
 				continue
 			}
 
-			var data map[string]interface{}
-			if err := json.Unmarshal(message, &data); err != nil {
+			msg, err := protocol.DecodeTwilio(message)
+			if err != nil {
 				zap.L().Error("Error parsing message", zap.Error(err))
 				continue
 			}
 
-			event, ok := data["event"].(string)
-			if !ok {
-				continue
-			}
+			switch msg.Event {
+			case protocol.TwilioEventStart:
+				streamSid = msg.Start.StreamSid
+				customParameters := msg.Start.CustomParameters
+				number, err := phone.Normalize(customParameters["number"])
+				if err != nil {
+					zap.L().Error("Invalid outbound number", zap.Error(err))
+					return
+				}
 
-			switch event {
-			case "start":
-				startData := data["start"].(map[string]interface{})
-				streamSid = startData["streamSid"].(string)
-				callSid = startData["callSid"].(string)
-				customParameters = startData["customParameters"].(map[string]interface{})
+				sess = svc.Sessions.Start(session.Outbound, msg.Start.CallSid, streamSid, number)
 
 				// check user data
-				userData, err := checkUserExists(customParameters["number"].(string))
+				userData, err := svc.Debtors.Resolve(r.Context(), number)
 				if err != nil {
 					zap.L().Error("Failed to check user", zap.Error(err))
 					return
 				}
+				sess.SetUserData(userData)
+				recordCallStart(r.Context(), svc, sess)
 
-				// init ElevenLabs
-				elevenLabsWs, err = initializeElevenLabs(customParameters,
-					userData,
-					cfg.ElevenLabsAgentID,
-					cfg.ElevenLabsAPIKey,
-					streamSid,
-				)
+				// start agent conversation
+				conversation, err := svc.Agent.Start(r.Context(), createAgentParams(customParameters, userData))
 				if err != nil {
-					zap.L().Error("Failed to initialize ElevenLabs", zap.Error(err))
+					zap.L().Error("Failed to start agent conversation", zap.Error(err))
+					finishCall(svc, sess, recorder, session.EndReasonAgentFailed)
 					return
 				}
+				svc.Sessions.Activate(sess)
 
-				// store conversation data
-				conv := &OutboundConversation{
-					CallSid: callSid,
-					Number:  customParameters["number"].(string),
+				bridge = newMediaBridge(conn, conversation, streamSid)
+				bridge.onConversationID = func(conversationID string) {
+					svc.Sessions.SetConversationID(sess, conversationID)
+				}
+				bridge.onTranscript = sess.AddTurn
+				bridge.onToolCall = func(call agent.ToolCall) (string, error) {
+					return handleToolCall(context.Background(), svc, sess, call)
+				}
+				if shouldRecord(cfg, customParameters) {
+					recorder = recording.NewRecorder()
+					bridge.recorder = recorder
 				}
-				outboundConversations.Store(callSid, conv)
+				go bridge.run()
 
-			case "media":
-				if elevenLabsWs != nil && !isDisconnecting {
-					mediaData := data["media"].(map[string]interface{})
-					payload := mediaData["payload"].(string)
+			case protocol.TwilioEventMedia:
+				if bridge != nil && !isDisconnecting {
+					payload := msg.Media.Payload
 
-					msg := map[string]interface{}{
-						"user_audio_chunk": payload,
-					}
-					if err := elevenLabsWs.WriteJSON(msg); err != nil {
-						zap.L().Error("Failed to send audio to ElevenLabs", zap.Error(err))
+					if err := bridge.forwardUserAudio(payload); err != nil {
+						zap.L().Error("Failed to send audio to agent", zap.Error(err))
 					}
 				}
 
-			case "stop":
+			case protocol.TwilioEventStop:
 				isDisconnecting = true
-				if elevenLabsWs != nil {
-					elevenLabsWs.WriteJSON(map[string]string{"type": "end_conversation"})
-					elevenLabsWs.Close()
+				if bridge == nil {
+					return
 				}
+				bridge.hangup()
 
 				// Send final webhook
-				if conv, ok := outboundConversations.Load(callSid); ok {
-					payload := map[string]interface{}{
-						"conversation_id": conv.(*OutboundConversation).ConversationID,
-						"phone_number":    conv.(*OutboundConversation).Number,
-						"call_sid":        conv.(*OutboundConversation).CallSid,
-					}
-
-					sendWebhook("outbound-calls", payload, cfg.N8NAuthToken)
-
-					outboundConversations.Delete(callSid)
-				}
+				finishCall(svc, sess, recorder, session.EndReasonCompleted)
 
 				// Send disconnect signals
-				conn.WriteJSON(map[string]interface{}{
+				bridge.sendToTwilio(map[string]interface{}{
 					"event":     "mark_done",
 					"streamSid": streamSid,
 				})
-				conn.WriteJSON(map[string]interface{}{
-					"event":     "clear",
-					"streamSid": streamSid,
-				})
+				bridge.sendToTwilio(protocol.NewTwilioClear(streamSid))
 				return
 			}
 		}
@@ -219,9 +248,9 @@ func HandleOutboundMediaStream(cfg *config.Config, upgrader websocket.Upgrader)
 
 // private
 
-func createTwilioCall(number, prompt, host, twilioPhoneNumber string) (*twilioApi.ApiV2010Call, error) {
-	callURL := fmt.Sprintf("https://%s/outbound-call-twiml?prompt=%s&number=%s",
-		host, url.QueryEscape(prompt), url.QueryEscape(number))
+func createTwilioCall(number, prompt, record, host, twilioPhoneNumber string) (*twilioApi.ApiV2010Call, error) {
+	callURL := fmt.Sprintf("https://%s/outbound-call-twiml?prompt=%s&number=%s&record=%s",
+		host, url.QueryEscape(prompt), url.QueryEscape(number), url.QueryEscape(record))
 
 	client := twilio.NewRestClient()
 
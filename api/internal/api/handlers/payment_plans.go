@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"claimsio/internal/n8n"
+	"claimsio/internal/payments"
+	"claimsio/internal/store"
+)
+
+const maxInstallments = 24
+
+type paymentPlanStore interface {
+	paymentLinkStore
+	store.PaymentPlanStore
+}
+
+type PaymentPlanRequest struct {
+	DebtorID string `json:"debtor_id"`
+	// in major units, e.g. 150.50
+	Amount   json.Number `json:"amount"`
+	Currency string      `json:"currency"`
+	// number of installments, 2 to 24
+	Installments int `json:"installments"`
+	// YYYY-MM-DD, defaults to today
+	FirstDueDate string `json:"first_due_date"`
+	// months between due dates, defaults to 1
+	IntervalMonths int `json:"interval_months"`
+	// creditor whose payment profile applies, remembered for the case
+	CreditorID string `json:"creditor_id"`
+}
+
+type PaymentPlanResponse struct {
+	*store.PaymentPlan
+	// a plan created earlier by the same request
+	Reused bool `json:"reused"`
+}
+
+// HandleCreatePaymentPlan splits the debt of the case in the path into
+// installments and issues a payment link for each. Like payment links, plans
+// are idempotent: the Idempotency-Key header, or the request itself, names
+// the plan, and repeating a request returns the stored plan.
+func HandleCreatePaymentPlan(svc *payments.Service, plans paymentPlanStore, hooks *n8n.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caseID := r.PathValue("id")
+
+		var params PaymentPlanRequest
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid request parameters", err)
+			return
+		}
+		debt, ok := parseAmount(w, params.Amount, params.Currency)
+		if !ok {
+			return
+		}
+		if params.Installments < 2 || params.Installments > maxInstallments {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid request parameters",
+				fmt.Errorf("installments must be between 2 and %d", maxInstallments))
+			return
+		}
+		if params.IntervalMonths < 0 {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid request parameters",
+				errors.New("interval_months must be positive"))
+			return
+		}
+		if params.IntervalMonths == 0 {
+			params.IntervalMonths = 1
+		}
+
+		firstDue := time.Now().UTC().Truncate(24 * time.Hour)
+		if params.FirstDueDate != "" {
+			var err error
+			firstDue, err = time.Parse(time.DateOnly, params.FirstDueDate)
+			if err != nil {
+				writeErrorResponse(w, http.StatusBadRequest, "invalid first_due_date", err)
+				return
+			}
+		}
+
+		environment := payments.EnvironmentFor(r.Context())
+		sc, err := svc.Client(environment)
+		if err != nil {
+			writeErrorResponse(w, http.StatusServiceUnavailable, "stripe is not configured", err)
+			return
+		}
+
+		profile, ok := resolveProfile(w, r, svc, plans, caseID, params.CreditorID, debt)
+		if !ok {
+			return
+		}
+
+		amount := debt.Amount
+		currency := debt.Currency.StripeCode()
+		if amount < int64(params.Installments) {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid request parameters",
+				errors.New("amount is too small for the number of installments"))
+			return
+		}
+
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		if idempotencyKey == "" {
+			idempotencyKey = fmt.Sprintf("%d:%s:%s:%d:%s:%d:%s", amount, currency, environment,
+				params.Installments, firstDue.Format(time.DateOnly), params.IntervalMonths, profile.Creditor)
+		}
+		sum := sha256.Sum256([]byte(caseID + ":" + idempotencyKey))
+		planID := "plan_" + hex.EncodeToString(sum[:12])
+
+		if existing, err := plans.GetPaymentPlan(r.Context(), planID); err == nil {
+			if err := rememberCaseCreditor(r.Context(), plans, caseID, params.CreditorID); err != nil {
+				writeErrorResponse(w, http.StatusInternalServerError, "failed to save case creditor", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, PaymentPlanResponse{PaymentPlan: existing, Reused: true})
+			return
+		} else if !errors.Is(err, store.ErrNotFound) {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to look up payment plans", err)
+			return
+		}
+
+		plan := &store.PaymentPlan{
+			ID:          planID,
+			CaseID:      caseID,
+			DebtorID:    params.DebtorID,
+			Amount:      amount,
+			Currency:    currency,
+			Environment: string(environment),
+			Status:      store.PaymentPlanActive,
+			CreatedAt:   time.Now().UTC(),
+		}
+
+		for i, part := range debt.Split(params.Installments) {
+			link := &store.PaymentLink{
+				CaseID:        caseID,
+				DebtorID:      params.DebtorID,
+				Amount:        part.Amount,
+				Currency:      currency,
+				Environment:   string(environment),
+				PaymentPlanID: planID,
+			}
+			// links already created by a failed attempt are returned by Stripe
+			if err := issuePaymentLink(r.Context(), sc, plans, link, profile, fmt.Sprintf("%s-%d", planID, i+1)); err != nil {
+				writeErrorResponse(w, http.StatusInternalServerError, "failed to create installment payment link", err)
+				return
+			}
+
+			plan.Installments = append(plan.Installments, store.Installment{
+				Number:        i + 1,
+				Amount:        part.Amount,
+				DueDate:       addMonths(firstDue, i*params.IntervalMonths),
+				Status:        store.InstallmentPending,
+				PaymentLinkID: link.ID,
+				PaymentURL:    link.URL,
+			})
+		}
+
+		if err := plans.CreatePaymentPlan(r.Context(), plan); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to save payment plan", err)
+			return
+		}
+		if err := rememberCaseCreditor(r.Context(), plans, caseID, params.CreditorID); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to save case creditor", err)
+			return
+		}
+
+		hookEvent, err := n8n.NewEvent("payment-plans", map[string]interface{}{
+			"type": "payment_plan.created",
+			"plan": plan,
+		})
+		if err == nil {
+			hookEvent.ID = planID + "_created"
+			err = hooks.NotifyEvent(r.Context(), hookEvent)
+		}
+		if err != nil {
+			fmt.Printf("Failed to send payment plan webhook for %s: %v\n", planID, err)
+		}
+
+		writeJSON(w, http.StatusOK, PaymentPlanResponse{PaymentPlan: plan})
+	})
+}
+
+// HandleListCasePaymentPlans returns the payment plans of the case in the
+// path with the status of each installment.
+func HandleListCasePaymentPlans(plans store.PaymentPlanStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		list, err := plans.ListCasePaymentPlans(r.Context(), r.PathValue("id"))
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to list payment plans", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, list)
+	})
+}
+
+// addMonths moves date by n months, keeping the day of month where it
+// exists and using the last day otherwise (31 January + 1 is 28 February).
+func addMonths(date time.Time, n int) time.Time {
+	first := time.Date(date.Year(), date.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(date.Day(), last)-1)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"claimsio/internal/config"
+	"claimsio/internal/payments"
+	"claimsio/internal/protocol"
+	"claimsio/internal/store"
+
+	"github.com/gorilla/websocket"
+	"github.com/stripe/stripe-go/v72"
+)
+
+// sequenceBackend numbers the payment links it creates.
+type sequenceBackend struct {
+	MockBackend
+	links int
+}
+
+func (b *sequenceBackend) Call(method, path, key string, params stripe.ParamsContainer, v stripe.LastResponseSetter) error {
+	if err := b.MockBackend.Call(method, path, key, params, v); err != nil {
+		return err
+	}
+	if link, ok := v.(*stripe.PaymentLink); ok {
+		b.mu.Lock()
+		b.links++
+		link.ID = fmt.Sprintf("plink_%d", b.links)
+		link.URL = fmt.Sprintf("https://stripe.com/pay/%d", b.links)
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+func createPaymentPlan(t *testing.T, handler http.Handler, caseID string, params PaymentPlanRequest) (*httptest.ResponseRecorder, PaymentPlanResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(params)
+	req := httptest.NewRequest(http.MethodPost, "/cases/"+caseID+"/payment-plans", bytes.NewBuffer(body))
+	req.SetPathValue("id", caseID)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var resp PaymentPlanResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+	}
+	return rr, resp
+}
+
+func TestCreatePaymentPlan(t *testing.T) {
+	env := newCallTestEnv(t)
+	backend := &sequenceBackend{}
+	handler := HandleCreatePaymentPlan(newPaymentsService(&config.Config{StripeAPIKeyTest: "sk_test"}, backend),
+		env.calls, env.svc.N8N)
+
+	params := PaymentPlanRequest{
+		DebtorID:     "debtor123",
+		Amount:       "100",
+		Currency:     "PLN",
+		Installments: 3,
+		FirstDueDate: "2026-01-31",
+	}
+	rr, resp := createPaymentPlan(t, handler, "case9", params)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+
+	plan := resp.PaymentPlan
+	if plan.CaseID != "case9" || plan.Amount != 10000 || plan.Currency != "pln" || plan.Status != store.PaymentPlanActive {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+	want := []struct {
+		amount int64
+		due    string
+	}{{3334, "2026-01-31"}, {3333, "2026-02-28"}, {3333, "2026-03-31"}}
+	if len(plan.Installments) != len(want) {
+		t.Fatalf("got %d installments, want %d", len(plan.Installments), len(want))
+	}
+	links := make(map[string]bool)
+	for i, in := range plan.Installments {
+		if in.Number != i+1 || in.Amount != want[i].amount || in.DueDate.Format("2006-01-02") != want[i].due ||
+			in.Status != store.InstallmentPending {
+			t.Errorf("installment %d = %+v, want %d due %s", i+1, in, want[i].amount, want[i].due)
+		}
+		links[in.PaymentLinkID] = true
+	}
+	if len(links) != 3 {
+		t.Errorf("installments share payment links: %+v", plan.Installments)
+	}
+
+	// installment links are not handed out as single payment links
+	if _, err := env.calls.FindPaymentLink(context.Background(), "case9", payments.DefaultCreditor, 3333, "pln", "test"); err != store.ErrNotFound {
+		t.Errorf("installment link reused for a single payment: %v", err)
+	}
+
+	webhooks := env.n8n.Webhooks("payment-plans")
+	if len(webhooks) != 1 || webhooks[0].Payload["type"] != "payment_plan.created" {
+		t.Errorf("unexpected payment plan webhooks: %+v", webhooks)
+	}
+
+	// a retry returns the stored plan
+	rr, retry := createPaymentPlan(t, handler, "case9", params)
+	if rr.Code != http.StatusOK || !retry.Reused || retry.ID != plan.ID {
+		t.Errorf("retry = %d %+v, want reuse of %s", rr.Code, retry.PaymentPlan, plan.ID)
+	}
+	if backend.links != 3 {
+		t.Errorf("payment links created = %d, want 3", backend.links)
+	}
+
+	// the first installment must carry at least one minor unit
+	rr, _ = createPaymentPlan(t, handler, "case9", PaymentPlanRequest{Amount: "0.02", Currency: "pln", Installments: 3})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("tiny plan: status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPaymentPlanInstallmentsFromStripe(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.cfg.StripeWebhookSecret = testStripeWebhookSecret
+	stripeClients := newPaymentsService(&config.Config{StripeAPIKeyTest: "sk_test"}, &sequenceBackend{})
+	create := HandleCreatePaymentPlan(stripeClients, env.calls, env.svc.N8N)
+	webhook := HandleStripeWebhook(env.cfg, stripeClients, env.calls, env.svc.N8N)
+
+	_, resp := createPaymentPlan(t, create, "case9", PaymentPlanRequest{
+		DebtorID: "debtor123", Amount: "50", Currency: "pln", Installments: 2,
+	})
+	plan := resp.PaymentPlan
+
+	for i, in := range plan.Installments {
+		event := fmt.Sprintf(`{"id":"evt_%d","type":"checkout.session.completed","created":1700000000,
+			"data":{"object":{"id":"cs_%d","object":"checkout.session","payment_intent":"pi_%d","payment_link":%q,
+			"payment_status":"paid","amount_total":%d,"currency":"pln","metadata":{"debtor_id":"debtor123","case_id":"case9"}}}}`,
+			i, i, i, in.PaymentLinkID, in.Amount)
+		if rr := postStripeEvent(t, webhook, event, testStripeWebhookSecret); rr.Code != http.StatusNoContent {
+			t.Fatalf("event returned status %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	plans, err := env.calls.ListCasePaymentPlans(context.Background(), "case9")
+	if err != nil || len(plans) != 1 {
+		t.Fatalf("got plans %+v, err %v", plans, err)
+	}
+	if plans[0].Status != store.PaymentPlanCompleted {
+		t.Errorf("plan status = %s, want %s", plans[0].Status, store.PaymentPlanCompleted)
+	}
+	for _, in := range plans[0].Installments {
+		if in.Status != store.InstallmentPaid || in.PaidAt == nil {
+			t.Errorf("installment %d not paid: %+v", in.Number, in)
+		}
+	}
+
+	webhooks := env.n8n.Webhooks("payments")
+	if len(webhooks) != 2 {
+		t.Fatalf("got %d payments webhooks, want 2", len(webhooks))
+	}
+	if p := webhooks[0].Payload; p["payment_plan_id"] != plan.ID || p["installment"] != float64(1) ||
+		p["payment_plan_status"] != store.PaymentPlanActive {
+		t.Errorf("unexpected first installment webhook: %v", p)
+	}
+	if p := webhooks[1].Payload; p["installment"] != float64(2) || p["payment_plan_status"] != store.PaymentPlanCompleted {
+		t.Errorf("unexpected last installment webhook: %v", p)
+	}
+}
+
+func TestMediaStreamPaymentPlanTool(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.n8n.Debtors["+48732145999"] = map[string]interface{}{"debtor_id": "debtor456"}
+	env.elevenLabs.ToolCalls = []protocol.ClientToolCall{{
+		ToolName:   PaymentPlanTool,
+		ToolCallID: "tool_1",
+		Parameters: map[string]interface{}{},
+	}}
+
+	create := HandleCreatePaymentPlan(newPaymentsService(&config.Config{StripeAPIKeyTest: "sk_test"}, &sequenceBackend{}),
+		env.calls, env.svc.N8N)
+	createPaymentPlan(t, create, "case9", PaymentPlanRequest{
+		DebtorID: "debtor456", Amount: "300", Currency: "pln", Installments: 2, FirstDueDate: "2026-02-10",
+	})
+
+	stream := dialStream(t, HandleOutboundMediaStream(env.cfg, websocket.Upgrader{}, env.svc))
+	if err := stream.Start(map[string]string{"number": "+48732145999"}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "tool result", func() bool { return len(env.elevenLabs.ToolResults()) == 1 })
+	result := env.elevenLabs.ToolResults()[0]
+	if result.IsError {
+		t.Fatalf("tool failed: %s", result.Result)
+	}
+	for _, want := range []string{"case case9", "300,00 zł in 2 installments", "installment 2: 150,00 zł due 2026-03-10, pending"} {
+		if !strings.Contains(result.Result, want) {
+			t.Errorf("tool result %q does not mention %q", result.Result, want)
+		}
+	}
+}
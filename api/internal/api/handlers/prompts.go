@@ -6,8 +6,12 @@ import (
 	"strings"
 
 	"claimsio/internal/ai"
+	"claimsio/internal/money"
 )
 
+// Debt amounts in prompt params are in the minor unit of Currency, e.g.
+// 15000 PLN is 150,00 zł. The prompts get them formatted for the debtor.
+// Currency defaults to PLN, which the prompts assumed before it was added.
 type InboundCallPromptParams struct {
 	Name         string `json:"name"`
 	CaseNumber   string `json:"case_number"`
@@ -37,6 +41,15 @@ type InitialMessagePromptParams struct {
 	Description string `json:"description"`
 }
 
+const defaultPromptCurrency = "PLN"
+
+func promptDebt(amount int64, currency string) (money.Money, error) {
+	if currency == "" {
+		currency = defaultPromptCurrency
+	}
+	return money.New(amount, currency)
+}
+
 func HandleGetPromptByNameParam(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -58,11 +71,16 @@ func HandleGetPromptByNameParam(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		debt, err := promptDebt(params.DebtAmount, params.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		prompt, err := ai.GenerateInboundCallPrompt(
 			params.Name,
 			params.CaseNumber,
-			params.DebtAmount,
-			params.Currency,
+			debt,
 			params.Phone,
 			params.PrevMessages,
 		)
@@ -86,11 +104,17 @@ func HandleGetPromptByNameParam(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		debt, err := promptDebt(params.DebtAmount, params.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		prompt, err := ai.GenerateOutboundCallPrompt(
 			params.Name,
+			params.Language,
 			params.CaseNumber,
-			params.DebtAmount,
-			params.Currency,
+			debt,
 			params.Phone,
 			params.PrevMessages,
 		)
@@ -114,13 +138,18 @@ func HandleGetPromptByNameParam(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		debt, err := promptDebt(params.DebtAmount, params.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		systemPrompt := ai.GetSystemPrompt()
 
 		prompt, err := ai.GenerateInitMessagePrompt(
 			params.Name,
 			params.CaseNumber,
-			params.DebtAmount,
-			params.Currency,
+			debt,
 			params.Phone,
 			params.Language,
 			params.Description,
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPromptsFormatDebtAmount(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"inbound-call", `{"name":"Jan","debt_amount":15000,"currency":"PLN"}`, "Debt Amount: 150,00 zł"},
+		{"outbound-call", `{"name":"John","language":"en","debt_amount":1250,"currency":"eur"}`, "Debt Amount: €12.50"},
+		{"init-message", `{"name":"Jan","language":"pl","debt_amount":1050,"currency":"PLN"}`, "Debt Amount: 10,50 zł"},
+		// requests from before currency was added are in złoty
+		{"outbound-call", `{"name":"Jan","language":"pl","debt_amount":15000}`, "Debt Amount: 150,00 zł"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/prompts/"+tt.name, bytes.NewBufferString(tt.body))
+		rr := httptest.NewRecorder()
+		HandleGetPromptByNameParam(rr, req)
+
+		var resp map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: failed to unmarshal response %q: %v", tt.name, rr.Body.String(), err)
+		}
+		if !strings.Contains(resp["prompt"], tt.want) {
+			t.Errorf("%s prompt does not contain %q:\n%s", tt.name, tt.want, resp["prompt"])
+		}
+		if strings.Contains(resp["prompt"], "%!") {
+			t.Errorf("%s prompt has formatting errors:\n%s", tt.name, resp["prompt"])
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/prompts/inbound-call",
+		bytes.NewBufferString(`{"debt_amount":100,"currency":"XYZ"}`))
+	rr := httptest.NewRecorder()
+	HandleGetPromptByNameParam(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown currency: status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
@@ -1,34 +1,52 @@
 package handlers
 
 import (
-	"claimsio/internal/config"
+	"claimsio/internal/money"
+	"claimsio/internal/payments"
+	"claimsio/internal/store"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
+	"time"
 
 	"github.com/stripe/stripe-go/v72"
-	"github.com/stripe/stripe-go/v72/paymentlink"
-	"github.com/stripe/stripe-go/v72/price"
-	"github.com/stripe/stripe-go/v72/product"
+	"github.com/stripe/stripe-go/v72/client"
 )
 
 // Test it
 type PaymentLinkRequest struct {
-	Amount      float64 `json:"amount"`
-	DebtorID    string  `json:"debtor_id"`
-	CaseID      string  `json:"case_id"`
-	Currency    string  `json:"currency"`
-	Environment string  `json:"environment"`
+	// in major units, e.g. 150.50
+	Amount   json.Number `json:"amount"`
+	DebtorID string      `json:"debtor_id"`
+	CaseID   string      `json:"case_id"`
+	Currency string      `json:"currency"`
+	// optional, "production" needs an API key with payments-live, any other
+	// value means test mode
+	Environment string `json:"environment"`
+	// creditor whose payment profile applies, remembered for the case
+	CreditorID string `json:"creditor_id"`
 }
 
 type PaymentLinkResponse struct {
 	PaymentURL    string `json:"payment_url"`
 	PaymentLinkID string `json:"payment_link_id"`
 	CaseID        string `json:"case_id"`
+	// an active link issued earlier for the same case and amount
+	Reused bool `json:"reused"`
 }
 
-func HandleCreatePaymentLink(cfg *config.Config) http.Handler {
+// HandleCreatePaymentLink issues a Stripe payment link for a case. Retries are
+// safe: an active link for the same case and amount is returned as is, and
+// Stripe calls carry the Idempotency-Key header, or a key derived from the
+// case, amount and currency when it is missing. The product and prices are
+// shared between cases. Links are created in live mode only for API keys
+// with the payments-live scope. Payment methods, redirect and labels come
+// from the profile of the case's creditor.
+func HandleCreatePaymentLink(svc *payments.Service, links paymentLinkStore) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// parse input parameters
 		var params PaymentLinkRequest
@@ -37,74 +55,100 @@ func HandleCreatePaymentLink(cfg *config.Config) http.Handler {
 			writeErrorResponse(w, http.StatusBadRequest, "invalid request parameters", err)
 			return
 		}
-
-		// set stripe api key based on environment
-		if params.Environment == "production" {
-			stripe.Key = cfg.StripeAPIKeyLive
-		} else {
-			stripe.Key = cfg.StripeAPIKeyTest
+		if params.CaseID == "" {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid request parameters",
+				errors.New("case_id is required"))
+			return
+		}
+		debt, ok := parseAmount(w, params.Amount, params.Currency)
+		if !ok {
+			return
 		}
 
-		// create product
-		productParams := &stripe.ProductParams{
-			Name: stripe.String(fmt.Sprintf("Debt payment")), //, params.DebtorID[:5], params.CaseID[:5])),
+		// the stripe account follows the caller's API key, never the body
+		environment := payments.EnvironmentFor(r.Context())
+		switch payments.Environment(params.Environment) {
+		case "":
+		case payments.Live:
+			if environment != payments.Live {
+				writeErrorResponse(w, http.StatusForbidden, "environment not allowed for this API key",
+					fmt.Errorf("requested %q, key is limited to %q", params.Environment, environment))
+				return
+			}
+		default:
+			// older callers send "development" and the like for test mode
+			environment = payments.Test
 		}
 
-		prod, err := product.New(productParams)
+		sc, err := svc.Client(environment)
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "failed to create stripe product", err)
+			writeErrorResponse(w, http.StatusServiceUnavailable, "stripe is not configured", err)
 			return
 		}
 
-		// create price
-		amount := int64(math.Round(params.Amount * 100))
-		priceParams := &stripe.PriceParams{
-			Currency:   stripe.String(params.Currency),
-			Product:    stripe.String(prod.ID),
-			UnitAmount: stripe.Int64(amount),
-		}
-		p, err := price.New(priceParams)
-		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "failed to create stripe price", err)
+		profile, ok := resolveProfile(w, r, svc, links, params.CaseID, params.CreditorID, debt)
+		if !ok {
 			return
 		}
 
-		// create payment link
-		linkParams := &stripe.PaymentLinkParams{
-			LineItems: []*stripe.PaymentLinkLineItemParams{
-				{
-					Price:    stripe.String(p.ID),
-					Quantity: stripe.Int64(1),
-				},
-			},
-			PaymentMethodTypes: stripe.StringSlice([]string{
-				"blik",
-				"p24",
-				"card",
-			}),
-			AfterCompletion: &stripe.PaymentLinkAfterCompletionParams{
-				Type: stripe.String("redirect"),
-				Redirect: &stripe.PaymentLinkAfterCompletionRedirectParams{
-					URL: stripe.String("https://pay.claimsio.com/dashboard"),
-				},
-			},
-		}
+		amount := debt.Amount
+		currency := debt.Currency.StripeCode()
 
-		linkParams.AddMetadata("debtor_id", params.DebtorID)
-		linkParams.AddMetadata("case_id", params.CaseID)
+		// reuse the link issued by an earlier attempt for the same creditor
+		existing, err := links.FindPaymentLink(r.Context(), params.CaseID, profile.Creditor, amount, currency, string(environment))
+		if err == nil {
+			if err := rememberCaseCreditor(r.Context(), links, params.CaseID, params.CreditorID); err != nil {
+				writeErrorResponse(w, http.StatusInternalServerError, "failed to save case creditor", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, PaymentLinkResponse{
+				CaseID:        params.CaseID,
+				PaymentURL:    existing.URL,
+				PaymentLinkID: existing.ID,
+				Reused:        true,
+			})
+			return
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to look up payment links", err)
+			return
+		}
 
-		link, err := paymentlink.New(linkParams)
+		// a case moved to another creditor gets a link with the new profile,
+		// Stripe rejects a key reused with different parameters
+		productName := profile.ProductNameFor(profile.Creditor, params.CaseID)
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		if idempotencyKey == "" {
+			idempotencyKey = paymentLinkKey(params.CaseID, profile.Creditor, productName, amount, currency, string(environment))
+		} else {
+			idempotencyKey = idempotencyKey + "-" + profile.Creditor
+		}
+		// Stripe would replay a paid, now inactive, link for the same key
+		inactive, err := links.CountInactivePaymentLinks(r.Context(), params.CaseID, string(environment))
 		if err != nil {
-			writeErrorResponse(w, http.StatusInternalServerError, "failed to create payment link", err)
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to look up payment links", err)
 			return
 		}
+		if inactive > 0 {
+			idempotencyKey = fmt.Sprintf("%s-%d", idempotencyKey, inactive)
+		}
 
-		// // // save payment link to supabase cases table
-		// updateQuery := fmt.Sprintf(`
-		// 	UPDATE cases
-		// 	SET payment_link_url = '%s'
-		// 	WHERE case_id = '%s'
-		// `, link.URL, params.CaseID)
+		link := &store.PaymentLink{
+			CaseID:      params.CaseID,
+			DebtorID:    params.DebtorID,
+			Amount:      amount,
+			Currency:    currency,
+			Environment: string(environment),
+		}
+		if err := issuePaymentLink(r.Context(), sc, links, link, profile, idempotencyKey); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to create payment link", err)
+			return
+		}
+		// a retry finds the link and saves the creditor again
+		if err := rememberCaseCreditor(r.Context(), links, params.CaseID, params.CreditorID); err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to save case creditor", err)
+			return
+		}
 
 		// write success response
 		writeJSON(w, http.StatusOK, PaymentLinkResponse{
@@ -115,6 +159,190 @@ func HandleCreatePaymentLink(cfg *config.Config) http.Handler {
 	})
 }
 
+// parseAmount reads a positive amount in a supported currency, answering 400
+// otherwise.
+func parseAmount(w http.ResponseWriter, amount json.Number, currency string) (money.Money, bool) {
+	m, err := money.Parse(amount.String(), currency)
+	if err == nil && m.Amount <= 0 {
+		err = errors.New("amount must be positive")
+	}
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, "invalid amount", err)
+		return money.Money{}, false
+	}
+	return m, true
+}
+
+type paymentLinkStore interface {
+	store.PaymentLinkStore
+	store.CaseStore
+}
+
+// linkProfile is the creditor profile applied to the payment links of a case.
+type linkProfile struct {
+	payments.Profile
+	Creditor string
+	// offered for the currency of the debt
+	Methods []string
+}
+
+// resolveProfile finds the creditor profile of a case, the one named in the
+// request or else the one remembered for the case. It answers 400 for unknown
+// creditors and 422 when the creditor does not take payments in the currency
+// of debt. Nothing is saved; see rememberCaseCreditor.
+func resolveProfile(w http.ResponseWriter, r *http.Request, svc *payments.Service, cases store.CaseStore, caseID, creditor string, debt money.Money) (linkProfile, bool) {
+	if creditor != "" {
+		if _, ok := svc.Profile(creditor); !ok {
+			writeErrorResponse(w, http.StatusBadRequest, "unknown creditor", fmt.Errorf("no payment profile for %q", creditor))
+			return linkProfile{}, false
+		}
+	} else {
+		stored, err := cases.GetCaseCreditor(r.Context(), caseID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to look up case creditor", err)
+			return linkProfile{}, false
+		}
+		creditor = stored
+	}
+
+	profile, ok := svc.Profile(creditor)
+	if !ok {
+		// the creditor's profile was removed since the case was assigned
+		fmt.Printf("No payment profile for creditor %s of case %s, using the default\n", creditor, caseID)
+		creditor = payments.DefaultCreditor
+		profile, _ = svc.Profile(creditor)
+	}
+	if creditor == "" {
+		creditor = payments.DefaultCreditor
+	}
+
+	methods, err := profile.PaymentMethodsFor(debt.Currency)
+	if err != nil {
+		writeErrorResponse(w, http.StatusUnprocessableEntity, "currency not accepted by the creditor", err)
+		return linkProfile{}, false
+	}
+
+	return linkProfile{Profile: profile, Creditor: creditor, Methods: methods}, true
+}
+
+// rememberCaseCreditor records the creditor named in a request for the case,
+// so later requests may leave it out. It is called once a link or plan has
+// been issued, a rejected request leaves the case with its creditor.
+func rememberCaseCreditor(ctx context.Context, cases store.CaseStore, caseID, creditor string) error {
+	if creditor == "" {
+		return nil
+	}
+	return cases.SetCaseCreditor(ctx, caseID, creditor)
+}
+
+// issuePaymentLink creates the Stripe payment link described by link and
+// records it. ID, URL, product and price are filled in from Stripe.
+func issuePaymentLink(ctx context.Context, sc *client.API, links store.PaymentLinkStore, link *store.PaymentLink, profile linkProfile, idempotencyKey string) error {
+	link.CreditorID = profile.Creditor
+	link.ProductName = profile.ProductNameFor(profile.Creditor, link.CaseID)
+
+	productID, priceID, err := debtPrice(ctx, sc, links, link, idempotencyKey)
+	if err != nil {
+		return fmt.Errorf("failed to create stripe price: %w", err)
+	}
+
+	linkParams := &stripe.PaymentLinkParams{
+		LineItems: []*stripe.PaymentLinkLineItemParams{
+			{
+				Price:    stripe.String(priceID),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		PaymentMethodTypes: stripe.StringSlice(profile.Methods),
+		AfterCompletion: &stripe.PaymentLinkAfterCompletionParams{
+			Type: stripe.String("redirect"),
+			Redirect: &stripe.PaymentLinkAfterCompletionRedirectParams{
+				URL: stripe.String(profile.SuccessURL),
+			},
+		},
+	}
+	if profile.StatementDescriptor != "" {
+		linkParams.AddExtra("payment_intent_data[statement_descriptor_suffix]", profile.StatementDescriptor)
+	}
+
+	linkParams.AddMetadata("debtor_id", link.DebtorID)
+	linkParams.AddMetadata("case_id", link.CaseID)
+	// copied to the payment intent so payment_intent.* webhooks can be
+	// matched to the case
+	linkParams.AddExtra("payment_intent_data[metadata][debtor_id]", link.DebtorID)
+	linkParams.AddExtra("payment_intent_data[metadata][case_id]", link.CaseID)
+	if link.PaymentPlanID != "" {
+		linkParams.AddMetadata("payment_plan_id", link.PaymentPlanID)
+		linkParams.AddExtra("payment_intent_data[metadata][payment_plan_id]", link.PaymentPlanID)
+	}
+	linkParams.SetIdempotencyKey(idempotencyKey + "-link")
+
+	created, err := sc.PaymentLinks.New(linkParams)
+	if err != nil {
+		return err
+	}
+
+	link.ID = created.ID
+	link.URL = created.URL
+	link.ProductID = productID
+	link.PriceID = priceID
+	link.Active = true
+	link.CreatedAt = time.Now().UTC()
+
+	if err := links.SavePaymentLink(ctx, link); err != nil {
+		fmt.Printf("Failed to save payment link %s: %v\n", link.ID, err)
+	}
+	return nil
+}
+
+// paymentLinkKey derives the Stripe idempotency key of a payment link request.
+func paymentLinkKey(caseID, creditor, productName string, amount int64, currency, environment string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s:%d:%s:%s", caseID, creditor, productName, amount, currency, environment)))
+	return "payment-link-" + hex.EncodeToString(sum[:16])
+}
+
+// debtPrice returns the product named for link and a price for its amount,
+// reusing those of earlier links and creating only what is missing.
+func debtPrice(ctx context.Context, sc *client.API, links store.PaymentLinkStore, link *store.PaymentLink, idempotencyKey string) (string, string, error) {
+	productID, priceID, err := links.FindPrice(ctx, link.Amount, link.Currency, link.Environment, link.ProductName)
+	if err == nil {
+		return productID, priceID, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return "", "", err
+	}
+
+	productID, err = links.FindProduct(ctx, link.Environment, link.ProductName)
+	if errors.Is(err, store.ErrNotFound) {
+		productParams := &stripe.ProductParams{
+			Name: stripe.String(link.ProductName),
+		}
+		productParams.SetIdempotencyKey(idempotencyKey + "-product")
+
+		prod, err := sc.Products.New(productParams)
+		if err != nil {
+			return "", "", err
+		}
+		productID = prod.ID
+	} else if err != nil {
+		return "", "", err
+	}
+
+	priceParams := &stripe.PriceParams{
+		Currency:   stripe.String(link.Currency),
+		Product:    stripe.String(productID),
+		UnitAmount: stripe.Int64(link.Amount),
+	}
+	priceParams.SetIdempotencyKey(idempotencyKey + "-price")
+
+	p, err := sc.Prices.New(priceParams)
+	if err != nil {
+		return "", "", err
+	}
+
+	return productID, p.ID, nil
+}
+
 // helper functions
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -3,18 +3,44 @@ package handlers
 import (
 	"bytes"
 	"claimsio/internal/config"
+	"claimsio/internal/middleware"
+	"claimsio/internal/payments"
+	"claimsio/internal/store"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stripe/stripe-go/v72"
 	"github.com/stripe/stripe-go/v72/form"
 )
 
-type MockBackend struct{}
+type MockBackend struct {
+	mu              sync.Mutex
+	calls           map[string]int
+	idempotencyKeys []string
+	// "METHOD path" of every call
+	requests []string
+}
 
 func (mb *MockBackend) Call(method, path, key string, params stripe.ParamsContainer, v stripe.LastResponseSetter) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.calls == nil {
+		mb.calls = make(map[string]int)
+	}
+	mb.calls[path]++
+	mb.requests = append(mb.requests, method+" "+path)
+	if params != nil {
+		if p := params.GetParams(); p.IdempotencyKey != nil {
+			mb.idempotencyKeys = append(mb.idempotencyKeys, *p.IdempotencyKey)
+		}
+	}
+
 	switch path {
 	case "/v1/products":
 		*(v.(*stripe.Product)) = stripe.Product{ID: "prod_1234567890"}
@@ -43,6 +69,14 @@ func (mb *MockBackend) CallStreaming(method, path, key string, params stripe.Par
 	return nil
 }
 
+func newPaymentsService(cfg *config.Config, backend stripe.Backend) *payments.Service {
+	return payments.NewService(cfg.StripeAPIKeyTest, cfg.StripeAPIKeyLive, &stripe.Backends{
+		API:     backend,
+		Connect: backend,
+		Uploads: backend,
+	})
+}
+
 func TestHandleCreatePaymentLink(t *testing.T) {
 	// Mock config
 	cfg := &config.Config{
@@ -52,13 +86,9 @@ func TestHandleCreatePaymentLink(t *testing.T) {
 	// Mock Stripe API calls
 	mockBackend := &MockBackend{}
 
-	// Set the mock backend for the API
-	stripe.SetBackend(stripe.APIBackend, mockBackend)
-	defer stripe.SetBackend(stripe.APIBackend, nil)
-
 	// Create request
 	reqBody := PaymentLinkRequest{
-		Amount:      100.50,
+		Amount:      "100.50",
 		DebtorID:    "debtor123",
 		CaseID:      "case456",
 		Currency:    "usd",
@@ -72,7 +102,7 @@ func TestHandleCreatePaymentLink(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the handler
-	handler := HandleCreatePaymentLink(cfg)
+	handler := HandleCreatePaymentLink(newPaymentsService(cfg, mockBackend), store.NewMemory())
 	handler.ServeHTTP(rr, req)
 
 	// Check status code
@@ -97,3 +127,358 @@ func TestHandleCreatePaymentLink(t *testing.T) {
 		t.Errorf("unexpected payment link ID: got %v want %v", resp.PaymentLinkID, expectedID)
 	}
 }
+
+func TestHandleCreatePaymentLinkReusesLink(t *testing.T) {
+	cfg := &config.Config{
+		StripeAPIKeyTest: "sk_test_1234567890",
+	}
+
+	mockBackend := &MockBackend{}
+	links := store.NewMemory()
+	handler := HandleCreatePaymentLink(newPaymentsService(cfg, mockBackend), links)
+
+	create := func(caseID string, amount json.Number) PaymentLinkResponse {
+		t.Helper()
+		body, _ := json.Marshal(PaymentLinkRequest{
+			Amount:   amount,
+			DebtorID: "debtor123",
+			CaseID:   caseID,
+			Currency: "PLN",
+		})
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/create-payment-link", bytes.NewBuffer(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+		}
+		var resp PaymentLinkResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		return resp
+	}
+
+	first := create("case456", "100.50")
+	if first.Reused {
+		t.Error("first link reported as reused")
+	}
+
+	second := create("case456", "100.50")
+	if !second.Reused || second.PaymentLinkID != first.PaymentLinkID || second.PaymentURL != first.PaymentURL {
+		t.Errorf("retry = %+v, want reuse of %+v", second, first)
+	}
+	if mockBackend.calls["/v1/payment_links"] != 1 {
+		t.Errorf("payment links created = %d, want 1", mockBackend.calls["/v1/payment_links"])
+	}
+
+	// another case with the same amount shares the product and price
+	create("case789", "100.50")
+	if mockBackend.calls["/v1/products"] != 1 || mockBackend.calls["/v1/prices"] != 1 {
+		t.Errorf("products created = %d, prices created = %d, want 1 each",
+			mockBackend.calls["/v1/products"], mockBackend.calls["/v1/prices"])
+	}
+	if mockBackend.calls["/v1/payment_links"] != 2 {
+		t.Errorf("payment links created = %d, want 2", mockBackend.calls["/v1/payment_links"])
+	}
+
+	for _, key := range mockBackend.idempotencyKeys {
+		if key == "" {
+			t.Error("stripe call without an idempotency key")
+		}
+	}
+	if len(mockBackend.idempotencyKeys) != 4 {
+		t.Errorf("idempotency keys = %v, want one per stripe call", mockBackend.idempotencyKeys)
+	}
+
+	// once the link is paid the same debt needs a new link, not a replay
+	if err := links.DeactivatePaymentLink(context.Background(), first.PaymentLinkID); err != nil {
+		t.Fatal(err)
+	}
+	if again := create("case456", "100.50"); again.Reused {
+		t.Error("deactivated link reused")
+	}
+	keys := mockBackend.idempotencyKeys
+	if last, firstLink := keys[len(keys)-1], keys[2]; last == firstLink || !strings.HasSuffix(last, "-link") {
+		t.Errorf("new link created with the key of the paid one: %s", last)
+	}
+}
+
+func TestHandleCreatePaymentLinkRequiresCase(t *testing.T) {
+	body, _ := json.Marshal(PaymentLinkRequest{Amount: "10", Currency: "pln"})
+	rr := httptest.NewRecorder()
+	HandleCreatePaymentLink(payments.NewService("sk_test", "", nil), store.NewMemory()).
+		ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/create-payment-link", bytes.NewBuffer(body)))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// keyEchoBackend puts the API key of each call into the returned link URL,
+// so a response shows which Stripe account created it.
+type keyEchoBackend struct {
+	MockBackend
+}
+
+func (b *keyEchoBackend) Call(method, path, key string, params stripe.ParamsContainer, v stripe.LastResponseSetter) error {
+	if err := b.MockBackend.Call(method, path, key, params, v); err != nil {
+		return err
+	}
+	if link, ok := v.(*stripe.PaymentLink); ok {
+		link.ID = "plink_" + key
+		link.URL = "https://stripe.com/pay/" + key
+	}
+	return nil
+}
+
+func TestHandleCreatePaymentLinkEnvironmentFromAPIKey(t *testing.T) {
+	cfg := &config.Config{
+		StripeAPIKeyTest: "sk_test_1234567890",
+		StripeAPIKeyLive: "sk_live_1234567890",
+		APIKeys: []config.APIKey{
+			{Name: "panel", Token: "panel-token", Scopes: []string{config.ScopePayments}},
+			{Name: "n8n", Token: "n8n-token", Scopes: []string{config.ScopePayments, config.ScopePaymentsLive}},
+			{Name: "admin", Token: "admin-token", Scopes: []string{config.ScopeAll}},
+		},
+	}
+	backend := &keyEchoBackend{}
+	handler := middleware.RequireAPIKey(cfg.APIKeys, config.ScopePayments,
+		HandleCreatePaymentLink(newPaymentsService(cfg, backend), store.NewMemory()))
+
+	create := func(token, caseID, environment string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(PaymentLinkRequest{
+			Amount:      "50",
+			CaseID:      caseID,
+			Currency:    "pln",
+			Environment: environment,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/payment-link", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// test and live requests interleave; each must reach its own account
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		for _, tc := range []struct{ token, wantKey string }{
+			{"panel-token", cfg.StripeAPIKeyTest},
+			{"n8n-token", cfg.StripeAPIKeyLive},
+		} {
+			wg.Add(1)
+			go func(token, wantKey string, i int) {
+				defer wg.Done()
+				rr := create(token, fmt.Sprintf("case-%s-%d", token, i), "")
+				if rr.Code != http.StatusOK {
+					errs <- fmt.Errorf("%s: status %d, body %s", token, rr.Code, rr.Body.String())
+					return
+				}
+				var resp PaymentLinkResponse
+				json.Unmarshal(rr.Body.Bytes(), &resp)
+				if !strings.HasSuffix(resp.PaymentURL, wantKey) {
+					errs <- fmt.Errorf("%s: link %s created with the wrong key, want %s", token, resp.PaymentURL, wantKey)
+				}
+			}(tc.token, tc.wantKey, i)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// the body cannot move a test-mode key to production
+	if rr := create("panel-token", "case-escalate", "production"); rr.Code != http.StatusForbidden {
+		t.Errorf("production request with a test key: status %d, want %d", rr.Code, http.StatusForbidden)
+	}
+	// "*" does not include live payments
+	if rr := create("admin-token", "case-escalate", "production"); rr.Code != http.StatusForbidden {
+		t.Errorf("production request with a \"*\" key: status %d, want %d", rr.Code, http.StatusForbidden)
+	}
+
+	// older callers name test mode "development"
+	for _, token := range []string{"panel-token", "n8n-token"} {
+		rr := create(token, "case-legacy-"+token, "development")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: development request returned status %d: %s", token, rr.Code, rr.Body.String())
+		}
+		var resp PaymentLinkResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if !strings.HasSuffix(resp.PaymentURL, cfg.StripeAPIKeyTest) {
+			t.Errorf("%s: development link %s not created in test mode", token, resp.PaymentURL)
+		}
+	}
+}
+
+func TestHandleCreatePaymentLinkLiveNotConfigured(t *testing.T) {
+	cfg := &config.Config{
+		StripeAPIKeyTest: "sk_test_1234567890",
+		APIKeys: []config.APIKey{
+			{Name: "admin", Token: "admin-token", Scopes: []string{config.ScopeAll, config.ScopePaymentsLive}},
+		},
+	}
+	handler := middleware.RequireAPIKey(cfg.APIKeys, config.ScopePayments,
+		HandleCreatePaymentLink(newPaymentsService(cfg, &MockBackend{}), store.NewMemory()))
+
+	body, _ := json.Marshal(PaymentLinkRequest{Amount: "50", CaseID: "case456", Currency: "pln"})
+	req := httptest.NewRequest(http.MethodPost, "/payment-link", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandleCreatePaymentLinkRejectsInvalidAmounts(t *testing.T) {
+	handler := HandleCreatePaymentLink(payments.NewService("sk_test", "", nil), store.NewMemory())
+
+	for _, params := range []PaymentLinkRequest{
+		{CaseID: "case456", Amount: "10.005", Currency: "pln"},
+		{CaseID: "case456", Amount: "-5", Currency: "pln"},
+		{CaseID: "case456", Amount: "10", Currency: "xyz"},
+	} {
+		body, _ := json.Marshal(params)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/create-payment-link", bytes.NewBuffer(body)))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: status = %d, want %d", params.Amount, params.Currency, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// paramsBackend records the payment link and product parameters sent to
+// Stripe.
+type paramsBackend struct {
+	MockBackend
+	links    []*stripe.PaymentLinkParams
+	products []string
+}
+
+func (b *paramsBackend) Call(method, path, key string, params stripe.ParamsContainer, v stripe.LastResponseSetter) error {
+	if err := b.MockBackend.Call(method, path, key, params, v); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch p := params.(type) {
+	case *stripe.PaymentLinkParams:
+		b.links = append(b.links, p)
+	case *stripe.ProductParams:
+		b.products = append(b.products, *p.Name)
+	}
+	return nil
+}
+
+func paymentMethods(p *stripe.PaymentLinkParams) string {
+	methods := make([]string, len(p.PaymentMethodTypes))
+	for i, m := range p.PaymentMethodTypes {
+		methods[i] = *m
+	}
+	return strings.Join(methods, ",")
+}
+
+func TestHandleCreatePaymentLinkCreditorProfiles(t *testing.T) {
+	backend := &paramsBackend{}
+	svc := newPaymentsService(&config.Config{StripeAPIKeyTest: "sk_test_1234567890"}, backend)
+	svc.Profiles = map[string]payments.Profile{
+		payments.DefaultCreditor: payments.DefaultProfiles[payments.DefaultCreditor],
+		"acme": {
+			PaymentMethods:      map[string][]string{"EUR": {"card", "ideal"}},
+			SuccessURL:          "https://pay.acme.example/thanks",
+			StatementDescriptor: "ACME DEBT",
+			ProductName:         "{creditor} debt",
+		},
+		"beta": {
+			PaymentMethods: map[string][]string{"*": {"card"}},
+			SuccessURL:     "https://beta.example/paid",
+			ProductName:    "Debt payment",
+		},
+	}
+	links := store.NewMemory()
+	handler := HandleCreatePaymentLink(svc, links)
+
+	create := func(params PaymentLinkRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(params)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/create-payment-link", bytes.NewBuffer(body)))
+		return rr
+	}
+
+	if rr := create(PaymentLinkRequest{CaseID: "case1", Amount: "20", Currency: "eur", CreditorID: "acme"}); rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	p := backend.links[0]
+	if got := stripe.StringValue(p.AfterCompletion.Redirect.URL); got != "https://pay.acme.example/thanks" {
+		t.Errorf("redirect = %q", got)
+	}
+	if got := paymentMethods(p); got != "card,ideal" {
+		t.Errorf("payment methods = %v, want card,ideal", got)
+	}
+	if got := p.Extra.Values.Get("payment_intent_data[statement_descriptor_suffix]"); got != "ACME DEBT" {
+		t.Errorf("statement descriptor = %q", got)
+	}
+	if len(backend.products) != 1 || backend.products[0] != "acme debt" {
+		t.Errorf("products = %v, want [acme debt]", backend.products)
+	}
+
+	// the creditor is remembered for the case
+	if rr := create(PaymentLinkRequest{CaseID: "case1", Amount: "35", Currency: "eur"}); rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	if got := stripe.StringValue(backend.links[1].AfterCompletion.Redirect.URL); got != "https://pay.acme.example/thanks" {
+		t.Errorf("redirect of a later link = %q", got)
+	}
+	if creditor, err := links.GetCaseCreditor(context.Background(), "case1"); err != nil || creditor != "acme" {
+		t.Errorf("case creditor = %q, %v", creditor, err)
+	}
+
+	// cases without a creditor use the default profile, card only for euro
+	if rr := create(PaymentLinkRequest{CaseID: "case2", Amount: "20", Currency: "eur"}); rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+	if got := paymentMethods(backend.links[2]); got != "card" {
+		t.Errorf("default euro payment methods = %v, want card", got)
+	}
+
+	// a case moved to another creditor gets a link with the new profile
+	rr := create(PaymentLinkRequest{CaseID: "case1", Amount: "20", Currency: "eur", CreditorID: "beta"})
+	var moved PaymentLinkResponse
+	json.Unmarshal(rr.Body.Bytes(), &moved)
+	if rr.Code != http.StatusOK || moved.Reused {
+		t.Fatalf("moved case: status %d, reused %v, body %s", rr.Code, moved.Reused, rr.Body.String())
+	}
+	if got := stripe.StringValue(backend.links[3].AfterCompletion.Redirect.URL); got != "https://beta.example/paid" {
+		t.Errorf("redirect after moving the case = %q", got)
+	}
+	linkKeys := make(map[string]bool)
+	for _, key := range backend.idempotencyKeys {
+		if strings.HasSuffix(key, "-link") {
+			if linkKeys[key] {
+				t.Errorf("idempotency key %s used for two links", key)
+			}
+			linkKeys[key] = true
+		}
+	}
+
+	if rr := create(PaymentLinkRequest{CaseID: "case3", Amount: "20", Currency: "eur", CreditorID: "nobody"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown creditor: status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	if rr := create(PaymentLinkRequest{CaseID: "case4", Amount: "20", Currency: "pln", CreditorID: "acme"}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("currency not accepted: status %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+
+	// a rejected request does not move the case
+	if rr := create(PaymentLinkRequest{CaseID: "case1", Amount: "20", Currency: "pln", CreditorID: "acme"}); rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("currency not accepted: status %d, want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if creditor, err := links.GetCaseCreditor(context.Background(), "case1"); err != nil || creditor != "beta" {
+		t.Errorf("case creditor after a rejected request = %q, %v, want beta", creditor, err)
+	}
+	if _, err := links.GetCaseCreditor(context.Background(), "case4"); err != store.ErrNotFound {
+		t.Errorf("creditor saved for a rejected case: %v", err)
+	}
+}
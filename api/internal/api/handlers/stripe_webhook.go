@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"claimsio/internal/config"
+	"claimsio/internal/n8n"
+	"claimsio/internal/payments"
+	"claimsio/internal/store"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+// Stripe events handled by HandleStripeWebhook, others are acknowledged and
+// ignored.
+const (
+	stripeCheckoutCompleted     = "checkout.session.completed"
+	stripePaymentSucceeded      = "payment_intent.succeeded"
+	stripePaymentFailed         = "payment_intent.payment_failed"
+	maxStripeWebhookPayloadSize = 65536
+)
+
+type stripeWebhookStore interface {
+	store.PaymentStore
+	store.PaymentLinkStore
+	store.PaymentPlanStore
+}
+
+// HandleStripeWebhook verifies Stripe events, stores the payment they
+// describe and reports it to n8n. The n8n event id is derived from the Stripe
+// event id, so redeliveries can be deduplicated downstream. Paid links are
+// deactivated in Stripe, through the account of the event's mode.
+func HandleStripeWebhook(cfg *config.Config, stripeClients *payments.Service, paymentStore stripeWebhookStore, hooks *n8n.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStripeWebhookPayloadSize))
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "failed to read request body", err)
+			return
+		}
+
+		event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), cfg.StripeWebhookSecret)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid stripe signature", err)
+			return
+		}
+
+		payment, err := paymentFromEvent(event)
+		if err != nil {
+			writeErrorResponse(w, http.StatusBadRequest, "invalid stripe event", err)
+			return
+		}
+		if payment == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if err := paymentStore.SavePayment(r.Context(), payment); err != nil {
+			// Stripe retries on errors
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to save payment", err)
+			return
+		}
+		// pick up the debtor, case and link recorded by earlier events
+		if stored, err := paymentStore.GetPayment(r.Context(), payment.PaymentIntentID); err == nil {
+			payment = stored
+		}
+		plan, installment := updateInstallment(r.Context(), paymentStore, payment)
+
+		data := map[string]interface{}{
+			"stripe_event_id":   event.ID,
+			"type":              event.Type,
+			"payment_intent_id": payment.PaymentIntentID,
+			"debtor_id":         payment.DebtorID,
+			"case_id":           payment.CaseID,
+			"amount":            payment.Amount,
+			"currency":          payment.Currency,
+			"status":            payment.Status,
+			"failure_message":   payment.FailureMessage,
+		}
+		if m, err := payment.Money(); err == nil {
+			data["formatted_amount"] = m.String()
+		}
+		if plan != nil {
+			data["payment_plan_id"] = plan.ID
+			data["payment_plan_status"] = plan.Status
+			data["installment"] = installment
+		}
+
+		hookEvent, err := n8n.NewEvent("payments", data)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to build payment event", err)
+			return
+		}
+		hookEvent.ID = "stripe_" + event.ID
+
+		// undelivered events stay in the n8n outbox, Stripe need not retry
+		if err := hooks.NotifyEvent(r.Context(), hookEvent); err != nil {
+			fmt.Printf("Failed to send payments webhook for %s: %v\n", event.ID, err)
+		}
+
+		// a paid link must not be paid again
+		if payment.PaymentLinkID != "" && payment.Status == store.PaymentSucceeded {
+			err := deactivatePaymentLink(r.Context(), stripeClients, paymentStore, event.Livemode, payment.PaymentLinkID)
+			if errors.Is(err, payments.ErrNotConfigured) {
+				// redelivery cannot help without the account's key
+				fmt.Printf("Failed to deactivate payment link %s: %v\n", payment.PaymentLinkID, err)
+			} else if err != nil {
+				// Stripe redelivers the event, n8n deduplicates it by id
+				writeErrorResponse(w, http.StatusInternalServerError, "failed to deactivate payment link", err)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// deactivatePaymentLink turns off a paid link in Stripe and then in the
+// store, so it is neither payable nor handed out again.
+func deactivatePaymentLink(ctx context.Context, stripeClients *payments.Service, links store.PaymentLinkStore, livemode bool, id string) error {
+	environment := payments.Test
+	if livemode {
+		environment = payments.Live
+	}
+	sc, err := stripeClients.Client(environment)
+	if err != nil {
+		return err
+	}
+
+	if _, err := sc.PaymentLinks.Update(id, &stripe.PaymentLinkParams{Active: stripe.Bool(false)}); err != nil {
+		return fmt.Errorf("failed to deactivate stripe payment link %s: %w", id, err)
+	}
+	return links.DeactivatePaymentLink(ctx, id)
+}
+
+// updateInstallment records the outcome of a payment made through an
+// installment link. It returns the updated plan and installment number, or a
+// nil plan when the payment is not part of one.
+func updateInstallment(ctx context.Context, plans store.PaymentPlanStore, payment *store.Payment) (*store.PaymentPlan, int) {
+	var status string
+	switch payment.Status {
+	case store.PaymentSucceeded:
+		status = store.InstallmentPaid
+	case store.PaymentFailed:
+		status = store.InstallmentFailed
+	default:
+		return nil, 0
+	}
+	if payment.PaymentLinkID == "" {
+		return nil, 0
+	}
+
+	plan, err := plans.UpdateInstallmentStatus(ctx, payment.PaymentLinkID, status, payment.UpdatedAt)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			fmt.Printf("Failed to update installment of payment link %s: %v\n", payment.PaymentLinkID, err)
+		}
+		return nil, 0
+	}
+
+	for _, in := range plan.Installments {
+		if in.PaymentLinkID == payment.PaymentLinkID {
+			return plan, in.Number
+		}
+	}
+	return plan, 0
+}
+
+// paymentFromEvent maps a Stripe event to the payment it updates. Debtor and
+// case come from the metadata set in HandleCreatePaymentLink. It returns nil
+// for events we do not handle and errors only for malformed payloads.
+func paymentFromEvent(event stripe.Event) (*store.Payment, error) {
+	payment := &store.Payment{UpdatedAt: time.Unix(event.Created, 0).UTC()}
+
+	switch event.Type {
+	case stripeCheckoutCompleted:
+		var session stripe.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+			return nil, err
+		}
+		if session.PaymentIntent == nil {
+			// zero-amount and subscription sessions collect no payment
+			fmt.Printf("Ignoring checkout session %s without a payment intent\n", session.ID)
+			return nil, nil
+		}
+		payment.PaymentIntentID = session.PaymentIntent.ID
+		payment.CheckoutSessionID = session.ID
+		if session.PaymentLink != nil {
+			payment.PaymentLinkID = session.PaymentLink.ID
+		}
+		payment.DebtorID = session.Metadata["debtor_id"]
+		payment.CaseID = session.Metadata["case_id"]
+		payment.Amount = session.AmountTotal
+		payment.Currency = string(session.Currency)
+		// BLIK and Przelewy24 may confirm after the session completes
+		payment.Status = store.PaymentPending
+		if session.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid {
+			payment.Status = store.PaymentSucceeded
+		}
+
+	case stripePaymentSucceeded, stripePaymentFailed:
+		var intent stripe.PaymentIntent
+		if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+			return nil, err
+		}
+		payment.PaymentIntentID = intent.ID
+		payment.DebtorID = intent.Metadata["debtor_id"]
+		payment.CaseID = intent.Metadata["case_id"]
+		payment.Amount = intent.Amount
+		payment.Currency = intent.Currency
+		payment.Status = store.PaymentSucceeded
+		if event.Type == stripePaymentFailed {
+			payment.Status = store.PaymentFailed
+			if intent.LastPaymentError != nil {
+				payment.FailureMessage = intent.LastPaymentError.Msg
+			}
+		}
+
+	default:
+		return nil, nil
+	}
+
+	return payment, nil
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"claimsio/internal/config"
+	"claimsio/internal/payments"
+	"claimsio/internal/store"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/webhook"
+)
+
+const testStripeWebhookSecret = "whsec_test"
+
+func postStripeEvent(t *testing.T, handler http.Handler, payload string, secret string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	now := time.Now()
+	signature := hex.EncodeToString(webhook.ComputeSignature(now, []byte(payload), secret))
+	req := httptest.NewRequest(http.MethodPost, "/stripe/webhook", bytes.NewBufferString(payload))
+	req.Header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", now.Unix(), signature))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestStripeWebhook(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.cfg.StripeWebhookSecret = testStripeWebhookSecret
+	backend := &MockBackend{}
+	handler := HandleStripeWebhook(env.cfg, newPaymentsService(&config.Config{StripeAPIKeyTest: "sk_test"}, backend),
+		env.calls, env.svc.N8N)
+
+	if rr := postStripeEvent(t, handler, `{"id":"evt_0","type":"payment_intent.succeeded"}`, "whsec_wrong"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("forged event returned status %d, want 400", rr.Code)
+	}
+
+	// the payment intent may succeed before the checkout session completes
+	events := []string{
+		`{"id":"evt_1","type":"payment_intent.succeeded","created":1700000000,
+			"data":{"object":{"id":"pi_1","object":"payment_intent","amount":12550,"currency":"pln","metadata":{}}}}`,
+		`{"id":"evt_2","type":"checkout.session.completed","created":1700000001,
+			"data":{"object":{"id":"cs_1","object":"checkout.session","payment_intent":"pi_1","payment_link":"plink_1",
+			"payment_status":"paid","amount_total":12550,"currency":"pln","metadata":{"debtor_id":"debtor123","case_id":"case9"}}}}`,
+		`{"id":"evt_3","type":"payment_intent.payment_failed","created":1700000002,
+			"data":{"object":{"id":"pi_1","object":"payment_intent","amount":12550,"currency":"pln",
+			"last_payment_error":{"message":"card declined"}}}}`,
+		`{"id":"evt_4","type":"customer.created","created":1700000003,"data":{"object":{"id":"cus_1"}}}`,
+		`{"id":"evt_5","type":"checkout.session.completed","created":1700000004,
+			"data":{"object":{"id":"cs_2","object":"checkout.session","mode":"subscription","payment_status":"no_payment_required",
+			"amount_total":0,"currency":"pln","metadata":{}}}}`,
+	}
+	for _, event := range events {
+		if rr := postStripeEvent(t, handler, event, testStripeWebhookSecret); rr.Code != http.StatusNoContent {
+			t.Fatalf("event returned status %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	payment, err := env.calls.GetPayment(context.Background(), "pi_1")
+	if err != nil {
+		t.Fatalf("payment not stored: %v", err)
+	}
+	if payment.Status != store.PaymentSucceeded || payment.DebtorID != "debtor123" || payment.CaseID != "case9" ||
+		payment.Amount != 12550 || payment.PaymentLinkID != "plink_1" {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+
+	webhooks := env.n8n.Webhooks("payments")
+	if len(webhooks) != 3 {
+		t.Fatalf("got %d payments webhooks, want 3", len(webhooks))
+	}
+	if p := webhooks[1].Payload; p["stripe_event_id"] != "evt_2" || p["debtor_id"] != "debtor123" || p["status"] != store.PaymentSucceeded {
+		t.Errorf("unexpected webhook payload: %v", p)
+	}
+	if p := webhooks[2].Payload; p["case_id"] != "case9" || p["status"] != store.PaymentSucceeded {
+		t.Errorf("late failure downgraded the payment: %v", p)
+	}
+
+	if backend.calls["/v1/payment_links/plink_1"] == 0 || backend.requests[0] != "POST /v1/payment_links/plink_1" {
+		t.Errorf("paid link not deactivated in stripe, requests %v", backend.requests)
+	}
+}
+
+// failingBackend fails every Stripe call.
+type failingBackend struct {
+	MockBackend
+}
+
+func (b *failingBackend) Call(method, path, key string, params stripe.ParamsContainer, v stripe.LastResponseSetter) error {
+	b.MockBackend.Call(method, path, key, params, v)
+	return &stripe.Error{Type: stripe.ErrorTypeAPI, Msg: "stripe is down"}
+}
+
+func TestStripeWebhookDeactivatesPaidLink(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.cfg.StripeWebhookSecret = testStripeWebhookSecret
+	ctx := context.Background()
+
+	link := &store.PaymentLink{ID: "plink_9", URL: "https://stripe.com/pay/9", CaseID: "case9", CreditorID: payments.DefaultCreditor, Amount: 5000,
+		Currency: "pln", Environment: "test", Active: true, CreatedAt: time.Now()}
+	if err := env.calls.SavePaymentLink(ctx, link); err != nil {
+		t.Fatal(err)
+	}
+	event := `{"id":"evt_9","type":"checkout.session.completed","created":1700000000,"livemode":false,
+		"data":{"object":{"id":"cs_9","object":"checkout.session","payment_intent":"pi_9","payment_link":"plink_9",
+		"payment_status":"paid","amount_total":5000,"currency":"pln","metadata":{"case_id":"case9"}}}}`
+
+	// the link stays active locally until Stripe has turned it off
+	failing := HandleStripeWebhook(env.cfg, newPaymentsService(&config.Config{StripeAPIKeyTest: "sk_test"}, &failingBackend{}),
+		env.calls, env.svc.N8N)
+	if rr := postStripeEvent(t, failing, event, testStripeWebhookSecret); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if _, err := env.calls.FindPaymentLink(ctx, "case9", payments.DefaultCreditor, 5000, "pln", "test"); err != nil {
+		t.Errorf("link deactivated although stripe failed: %v", err)
+	}
+
+	// Stripe redelivers the event
+	backend := &MockBackend{}
+	handler := HandleStripeWebhook(env.cfg, newPaymentsService(&config.Config{StripeAPIKeyTest: "sk_test"}, backend),
+		env.calls, env.svc.N8N)
+	if rr := postStripeEvent(t, handler, event, testStripeWebhookSecret); rr.Code != http.StatusNoContent {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(backend.requests) != 1 || backend.requests[0] != "POST /v1/payment_links/plink_9" {
+		t.Errorf("stripe requests = %v, want the link update", backend.requests)
+	}
+	if _, err := env.calls.FindPaymentLink(ctx, "case9", payments.DefaultCreditor, 5000, "pln", "test"); err != store.ErrNotFound {
+		t.Errorf("paid link still active: %v", err)
+	}
+}
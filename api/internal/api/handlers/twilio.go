@@ -1,10 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
+	"claimsio/internal/compliance"
 	"claimsio/internal/config"
+	"claimsio/internal/debtor"
+	"claimsio/internal/phone"
+	"claimsio/internal/sms"
+	"claimsio/internal/store"
 
 	twilio "github.com/twilio/twilio-go"
 	openapi "github.com/twilio/twilio-go/rest/api/v2010"
@@ -13,15 +22,24 @@ import (
 type SMSRequest struct {
 	To      string `json:"to"`
 	Message string `json:"message"`
+	// debtor's IANA timezone for contact hours, the country's when empty
+	Timezone string `json:"timezone,omitempty"`
+	// overrides SMS_TRANSLITERATE for this message when set
+	Transliterate *bool `json:"transliterate,omitempty"`
 }
 
 type SMSResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	SID     string `json:"sid,omitempty"`
+	Success  bool         `json:"success"`
+	Message  string       `json:"message"`
+	SID      string       `json:"sid,omitempty"`
+	Segments int          `json:"segments,omitempty"`
+	Encoding sms.Encoding `json:"encoding,omitempty"`
 }
 
-func HandleSendSMS(cfg *config.Config) http.HandlerFunc {
+// HandleSendSMS sends an SMS to a debtor and reports how many segments it
+// was billed as. When SMS_MAX_SEGMENTS is set, longer messages are refused
+// with 422; by default there is no limit.
+func HandleSendSMS(cfg *config.Config, svc *CallServices) http.HandlerFunc {
 	// initialize twilio client
 	client := twilio.NewRestClientWithParams(twilio.ClientParams{
 		Username: cfg.TwilioAccountSID,
@@ -47,11 +65,46 @@ func HandleSendSMS(cfg *config.Config) http.HandlerFunc {
 			return
 		}
 
+		to, err := phone.Normalize(req.To)
+		if err != nil {
+			http.Error(w, "Invalid phone number", http.StatusBadRequest)
+			return
+		}
+
+		body := req.Message
+		transliterate := cfg.SMSTransliterate
+		if req.Transliterate != nil {
+			transliterate = *req.Transliterate
+		}
+		if transliterate {
+			body = sms.Transliterate(body)
+		}
+		info := sms.Analyze(body)
+		if cfg.SMSMaxSegments > 0 && info.Segments > cfg.SMSMaxSegments {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"success":      false,
+				"message":      fmt.Sprintf("message needs %d %s segments, the limit is %d", info.Segments, info.Encoding, cfg.SMSMaxSegments),
+				"segments":     info.Segments,
+				"encoding":     info.Encoding,
+				"length":       info.Length,
+				"max_segments": cfg.SMSMaxSegments,
+			})
+			return
+		}
+
+		// held until the message is recorded, so concurrent requests cannot
+		// all pass the caps
+		defer svc.Compliance.Lock(to, compliance.ChannelSMS)()
+		if !allowContact(w, r, svc.Compliance, to, compliance.ChannelSMS, req.Timezone) {
+			return
+		}
+
 		// prepare twilio params
 		params := &openapi.CreateMessageParams{}
-		params.SetTo(req.To)
+		params.SetTo(to)
 		params.SetFrom(cfg.TwilioPhoneNumber)
-		params.SetBody(req.Message)
+		params.SetBody(body)
+		params.SetStatusCallback(fmt.Sprintf("https://%s/sms-status", r.Host))
 
 		// send sms
 		resp, err := client.Api.CreateMessage(params)
@@ -59,12 +112,16 @@ func HandleSendSMS(cfg *config.Config) http.HandlerFunc {
 			http.Error(w, "Failed to send SMS", http.StatusInternalServerError)
 			return
 		}
+		recordContact(r, svc.Compliance, to, compliance.ChannelSMS, *resp.Sid)
+		saveOutboundMessage(r.Context(), svc, to, body, resp)
 
 		// prepare response
 		response := SMSResponse{
-			Success: true,
-			Message: "SMS sent successfully",
-			SID:     *resp.Sid,
+			Success:  true,
+			Message:  "SMS sent successfully",
+			SID:      *resp.Sid,
+			Segments: info.Segments,
+			Encoding: info.Encoding,
 		}
 
 		// send response
@@ -72,3 +129,86 @@ func HandleSendSMS(cfg *config.Config) http.HandlerFunc {
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// saveOutboundMessage adds a sent SMS to the debtor's history. Errors are
+// logged, the message is already on its way.
+func saveOutboundMessage(ctx context.Context, svc *CallServices, to, body string, resp *openapi.ApiV2010Message) {
+	var debtorID string
+	userData, err := svc.Debtors.Resolve(ctx, to)
+	switch {
+	case err == nil:
+		debtorID, _ = userData["debtor_id"].(string)
+	case !errors.Is(err, debtor.ErrNotFound):
+		fmt.Printf("Failed to resolve debtor for %s: %v\n", to, err)
+	}
+
+	status := store.MessageQueued
+	if resp.Status != nil {
+		status = *resp.Status
+	}
+
+	err = svc.Store.SaveMessage(ctx, &store.Message{
+		MessageSid: *resp.Sid,
+		Direction:  "outbound",
+		Phone:      to,
+		DebtorID:   debtorID,
+		Body:       body,
+		Status:     status,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		fmt.Printf("Failed to save message %s: %v\n", *resp.Sid, err)
+	}
+}
+
+// HandleSMSStatus records Twilio delivery reports for sent messages.
+func HandleSMSStatus(svc *CallServices) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		messageSid := r.FormValue("MessageSid")
+		status := r.FormValue("MessageStatus")
+		if messageSid == "" || status == "" {
+			http.Error(w, "Missing required fields", http.StatusBadRequest)
+			return
+		}
+
+		err := svc.Store.UpdateMessageStatus(r.Context(), messageSid, store.MessageStatus{
+			Status:    status,
+			ErrorCode: r.FormValue("ErrorCode"),
+			UpdatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			fmt.Printf("Failed to record status %s of message %s: %v\n", status, messageSid, err)
+			http.Error(w, "Failed to record status", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// HandleListDebtorMessages returns every SMS exchanged with a debtor with
+// its delivery status.
+func HandleListDebtorMessages(svc *CallServices) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		debtorID := r.PathValue("id")
+
+		messages, err := svc.Store.ListDebtorMessages(r.Context(), debtorID)
+		if err != nil {
+			writeErrorResponse(w, http.StatusInternalServerError, "failed to load messages", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			DebtorID string          `json:"debtor_id"`
+			Messages []store.Message `json:"messages"`
+		}{
+			DebtorID: debtorID,
+			Messages: messages,
+		})
+	})
+}
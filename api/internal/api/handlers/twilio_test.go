@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"claimsio/internal/store"
+)
+
+func TestSMSStatusAndHistory(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.n8n.Debtors["+48732145999"] = map[string]interface{}{"debtor_id": "debtor123"}
+	ctx := context.Background()
+
+	err := env.calls.SaveMessage(ctx, &store.Message{
+		MessageSid: "SM1",
+		Direction:  "outbound",
+		Phone:      "+48732145999",
+		DebtorID:   "debtor123",
+		Body:       "Your payment is due",
+		Status:     store.MessageQueued,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := HandleSMSStatus(env.svc)
+	// the late "sent" report must not overwrite the final status
+	for _, report := range []url.Values{
+		{"MessageSid": {"SM1"}, "MessageStatus": {"sent"}},
+		{"MessageSid": {"SM1"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}},
+		{"MessageSid": {"SM1"}, "MessageStatus": {"sent"}},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/sms-status", strings.NewReader(report.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		status.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("status callback returned %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	postInboundSMS(t, HandleInboundSMS(env.svc), "SM2", "+48732145999", "I paid yesterday")
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /debtors/{id}/messages", HandleListDebtorMessages(env.svc))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debtors/debtor123/messages", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("messages returned status %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var history struct {
+		DebtorID string          `json:"debtor_id"`
+		Messages []store.Message `json:"messages"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(history.Messages))
+	}
+	if m := history.Messages[0]; m.Status != store.MessageUndelivered || m.ErrorCode != "30003" || m.StatusUpdatedAt == nil {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	if m := history.Messages[1]; m.Direction != "inbound" || m.Status != store.MessageReceived {
+		t.Errorf("unexpected reply: %+v", m)
+	}
+}
+
+func TestSendSMSSegmentLimit(t *testing.T) {
+	env := newCallTestEnv(t)
+	env.cfg.SMSMaxSegments = 1
+	handler := HandleSendSMS(env.cfg, env.svc)
+
+	// 80 Polish characters need two UCS-2 segments
+	body, _ := json.Marshal(SMSRequest{To: "+48732145999", Message: strings.Repeat("Zażółć ", 10) + "gęślą jaźń"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/send-sms", strings.NewReader(string(body))))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d want 422: %s", rr.Code, rr.Body.String())
+	}
+
+	var refusal struct {
+		Segments int    `json:"segments"`
+		Encoding string `json:"encoding"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &refusal); err != nil {
+		t.Fatal(err)
+	}
+	if refusal.Segments != 2 || refusal.Encoding != "UCS-2" {
+		t.Errorf("unexpected refusal: %+v", refusal)
+	}
+}
@@ -3,17 +3,35 @@ package api
 import (
 	"net/http"
 
+	"claimsio/internal/agent"
 	h "claimsio/internal/api/handlers"
+	"claimsio/internal/compliance"
 	"claimsio/internal/config"
+	"claimsio/internal/debtor"
 	"claimsio/internal/middleware"
+	"claimsio/internal/n8n"
+	"claimsio/internal/payments"
+	"claimsio/internal/recording"
+	"claimsio/internal/session"
+	"claimsio/internal/store"
 
 	"github.com/gorilla/websocket"
 )
 
-func NewRouter(cfg *config.Config, upgrader websocket.Upgrader) http.Handler {
+func NewRouter(cfg *config.Config, upgrader websocket.Upgrader, st store.Store, hooks *n8n.Client, debtors debtor.Resolver, contacts *compliance.Engine, stripeClients *payments.Service) http.Handler {
 	mux := http.NewServeMux()
 
 	// Create handler dependencies
+	calls := &h.CallServices{
+		Sessions:   session.NewManager(),
+		Agent:      newConversationalAgent(cfg),
+		Store:      st,
+		Recordings: recording.NewLocalStore(cfg.RecordingsDir),
+		N8N:        hooks,
+		Debtors:    debtors,
+		Compliance: contacts,
+	}
+
 	// middleware
 	// apiHandler = middleware.Logging(apiHandler)
 
@@ -21,23 +39,58 @@ func NewRouter(cfg *config.Config, upgrader websocket.Upgrader) http.Handler {
 	// mux.HandleFunc("/up", h.HealthCheck)
 
 	// Twilio x ElevenLabs
-	mux.Handle("/incoming-call-eleven", h.HandleInboundCall(cfg, upgrader))
-	mux.Handle("/outbound-call", h.HandleOutboundCall(cfg))
-	mux.Handle("/outbound-call-twiml", h.HandleOutboundCallTwiml(cfg))
-	mux.Handle("/media-stream", h.HandleInboundMediaStream(cfg, upgrader))
-	mux.Handle("/outbound-media-stream", h.HandleOutboundMediaStream(cfg, upgrader))
+	mux.Handle("/incoming-call-eleven", twilioOnly(cfg, h.HandleInboundCall(cfg, calls)))
+	mux.Handle("/outbound-call", apiKey(cfg, config.ScopeCalls, h.HandleOutboundCall(cfg, contacts)))
+	mux.Handle("/outbound-call-twiml", twilioOnly(cfg, h.HandleOutboundCallTwiml(cfg)))
+	mux.Handle("/media-stream", twilioOnly(cfg, h.HandleInboundMediaStream(cfg, upgrader, calls)))
+	mux.Handle("/outbound-media-stream", twilioOnly(cfg, h.HandleOutboundMediaStream(cfg, upgrader, calls)))
+
+	// Calls
+	mux.Handle("GET /calls", apiKey(cfg, config.ScopeCalls, h.HandleListActiveCalls(calls.Sessions)))
+	mux.Handle("GET /calls/{callSid}/transcript", apiKey(cfg, config.ScopeCalls, h.HandleGetCallTranscript(calls)))
 
 	// Stripe
-	mux.Handle("/payment-link", h.HandleCreatePaymentLink(cfg))
+	mux.Handle("/payment-link", apiKey(cfg, config.ScopePayments, h.HandleCreatePaymentLink(stripeClients, st)))
+	mux.Handle("POST /cases/{id}/payment-plans", apiKey(cfg, config.ScopePayments, h.HandleCreatePaymentPlan(stripeClients, st, hooks)))
+	mux.Handle("GET /cases/{id}/payment-plans", apiKey(cfg, config.ScopePayments, h.HandleListCasePaymentPlans(st)))
+	mux.Handle("POST /stripe/webhook", h.HandleStripeWebhook(cfg, stripeClients, st, hooks))
 
 	// Twilio
-	mux.Handle("/send-sms", h.HandleSendSMS(cfg))
+	mux.Handle("/send-sms", apiKey(cfg, config.ScopeSMS, h.HandleSendSMS(cfg, calls)))
+	mux.Handle("/sms-status", twilioOnly(cfg, h.HandleSMSStatus(calls)))
+	mux.Handle("GET /debtors/{id}/messages", apiKey(cfg, config.ScopeSMS, h.HandleListDebtorMessages(calls)))
+	mux.Handle("/incoming-sms", twilioOnly(cfg, h.HandleInboundSMS(calls)))
 
 	// Prompts
-	mux.HandleFunc("/prompts/", h.HandleGetPromptByNameParam) // Note the trailing slash
+	mux.Handle("/prompts/", apiKey(cfg, config.ScopePrompts, http.HandlerFunc(h.HandleGetPromptByNameParam))) // Note the trailing slash
 
 	var handler http.Handler = mux
 	handler = middleware.Logging(handler)
 
 	return handler
 }
+
+// apiKey guards the control endpoints called by n8n and the panels.
+func apiKey(cfg *config.Config, scope string, next http.Handler) http.Handler {
+	return middleware.RequireAPIKey(cfg.APIKeys, scope, next)
+}
+
+// twilioOnly guards routes that only Twilio should call.
+func twilioOnly(cfg *config.Config, next http.Handler) http.Handler {
+	if !cfg.TwilioValidateSignature {
+		return next
+	}
+	return middleware.TwilioSignature(cfg.TwilioAuthToken, next)
+}
+
+// newConversationalAgent picks the voice agent backing phone calls. The
+// scripted agent needs no credentials and is meant for local demos.
+func newConversationalAgent(cfg *config.Config) agent.Conversational {
+	if cfg.AgentProvider == "scripted" {
+		return agent.NewScripted(agent.Event{
+			Type: agent.EventAgentResponse,
+			Text: "Hello, this is a demo call from Claimsio.",
+		})
+	}
+	return agent.NewElevenLabs(cfg.ElevenLabsAPIKey, cfg.ElevenLabsAgentID)
+}
@@ -0,0 +1,232 @@
+// Package compliance decides whether a debtor may be contacted right now,
+// following their opt-outs and the contact hours and frequency caps of their
+// country.
+package compliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"claimsio/internal/phone"
+	"claimsio/internal/store"
+)
+
+type Channel string
+
+const (
+	ChannelCall Channel = "call"
+	ChannelSMS  Channel = "sms"
+)
+
+// Refusal codes returned to n8n.
+const (
+	CodeOptedOut                = "opted_out"
+	CodeOutsideHours            = "outside_contact_hours"
+	CodeDailyCap                = "daily_cap_reached"
+	CodeWeeklyCap               = "weekly_cap_reached"
+	CodeUnsupportedJurisdiction = "unsupported_jurisdiction"
+)
+
+var ErrInvalidTimezone = errors.New("compliance: invalid timezone")
+
+// Refusal explains why a contact is not allowed and, when known, the
+// earliest time it may be retried.
+type Refusal struct {
+	Code         string     `json:"code"`
+	Reason       string     `json:"reason"`
+	Channel      Channel    `json:"channel"`
+	Jurisdiction string     `json:"jurisdiction,omitempty"`
+	RetryAfter   *time.Time `json:"retry_after,omitempty"`
+	// the opt-out that blocked the contact, for CodeOptedOut
+	OptOut *store.OptOut `json:"opt_out,omitempty"`
+}
+
+func (r *Refusal) Error() string {
+	return fmt.Sprintf("compliance: %s", r.Reason)
+}
+
+// Engine checks outbound contacts against the debtor's opt-outs, the rules
+// of their country and their contact history.
+type Engine struct {
+	rules    map[string]Rules
+	contacts store.ContactStore
+	optOuts  store.OptOutStore
+	now      func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]*contactLock
+}
+
+type contactLock struct {
+	sync.Mutex
+	// holders and waiters, the lock is dropped when none are left
+	refs int
+}
+
+func NewEngine(rules map[string]Rules, contacts store.ContactStore, optOuts store.OptOutStore) *Engine {
+	return &Engine{
+		rules:    rules,
+		contacts: contacts,
+		optOuts:  optOuts,
+		now:      time.Now,
+		locks:    make(map[string]*contactLock),
+	}
+}
+
+// Lock serializes contacts to number on channel. Hold it from Check until
+// the contact is recorded, otherwise concurrent requests can all pass a cap
+// before any of them is counted.
+func (e *Engine) Lock(number string, channel Channel) (unlock func()) {
+	key := string(channel) + ":" + number
+
+	e.mu.Lock()
+	l, ok := e.locks[key]
+	if !ok {
+		l = &contactLock{}
+		e.locks[key] = l
+	}
+	l.refs++
+	e.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		e.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(e.locks, key)
+		}
+		e.mu.Unlock()
+	}
+}
+
+// Check returns a *Refusal when the E.164 number may not be contacted on
+// channel now. timezone is the debtor's IANA timezone, the jurisdiction's
+// default is used when it is empty.
+func (e *Engine) Check(ctx context.Context, number string, channel Channel, timezone string) error {
+	optOut, err := e.optOuts.GetOptOut(ctx, number, string(channel))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to check opt-outs: %w", err)
+	}
+	if optOut != nil {
+		return &Refusal{
+			Code:    CodeOptedOut,
+			Reason:  fmt.Sprintf("debtor opted out of %s contact", channel),
+			Channel: channel,
+			OptOut:  optOut,
+		}
+	}
+
+	country, _ := phone.Region(number)
+	rules, ok := e.rules[country]
+	if !ok {
+		return &Refusal{
+			Code:    CodeUnsupportedJurisdiction,
+			Reason:  fmt.Sprintf("no contact rules for %s", number),
+			Channel: channel,
+		}
+	}
+
+	if timezone == "" {
+		timezone = rules.Timezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidTimezone, timezone)
+	}
+	now := e.now().In(loc)
+
+	refuse := func(code, reason string, retryAfter time.Time) error {
+		r := &Refusal{Code: code, Reason: reason, Channel: channel, Jurisdiction: country}
+		if !retryAfter.IsZero() {
+			retryAfter = retryAfter.UTC()
+			r.RetryAfter = &retryAfter
+		}
+		return r
+	}
+
+	if open := rules.nextOpening(now); !open.Equal(now) {
+		return refuse(CodeOutsideHours, fmt.Sprintf("outside permitted contact hours in %s", timezone), open)
+	}
+
+	limit := rules.Caps[channel]
+	if limit.PerDay > 0 {
+		since := startOfDay(now)
+		count, err := e.contacts.CountContacts(ctx, number, string(channel), since)
+		if err != nil {
+			return fmt.Errorf("failed to count contacts: %w", err)
+		}
+		if count >= limit.PerDay {
+			return refuse(CodeDailyCap, fmt.Sprintf("daily limit of %d %s contacts reached", limit.PerDay, channel),
+				rules.nextOpening(since.AddDate(0, 0, 1)))
+		}
+	}
+	if limit.PerWeek > 0 {
+		since := startOfWeek(now)
+		count, err := e.contacts.CountContacts(ctx, number, string(channel), since)
+		if err != nil {
+			return fmt.Errorf("failed to count contacts: %w", err)
+		}
+		if count >= limit.PerWeek {
+			return refuse(CodeWeeklyCap, fmt.Sprintf("weekly limit of %d %s contacts reached", limit.PerWeek, channel),
+				rules.nextOpening(since.AddDate(0, 0, 7)))
+		}
+	}
+
+	return nil
+}
+
+// Record adds a placed contact to the history counted by Check. reference is
+// the Twilio call or message sid.
+func (e *Engine) Record(ctx context.Context, number string, channel Channel, reference string) error {
+	return e.contacts.RecordContact(ctx, &store.Contact{
+		Phone:       number,
+		Channel:     string(channel),
+		Reference:   reference,
+		ContactedAt: e.now().UTC(),
+	})
+}
+
+// nextOpening returns t when it falls inside a contact window and otherwise
+// the start of the next window, or the zero time when the rules have none.
+func (r Rules) nextOpening(t time.Time) time.Time {
+	for i := 0; i < 8; i++ {
+		day := t
+		if i > 0 {
+			day = startOfDay(t).AddDate(0, 0, i)
+		}
+		w := r.window(day.Weekday())
+		if w == nil {
+			continue
+		}
+		opens, closes := w.bounds(day)
+		if day.Before(opens) {
+			return opens
+		}
+		if day.Before(closes) {
+			return day
+		}
+	}
+	return time.Time{}
+}
+
+// OptOut registers that number must not be contacted on channel again.
+// source says where the request came from, e.g. SourceSMSKeyword.
+func (e *Engine) OptOut(ctx context.Context, number string, channel Channel, reason, source string) error {
+	return e.optOuts.AddOptOut(ctx, &store.OptOut{
+		Phone:     number,
+		Channel:   string(channel),
+		Reason:    reason,
+		Source:    source,
+		CreatedAt: e.now().UTC(),
+	})
+}
+
+// OptIn lifts the opt-out of number on channel.
+func (e *Engine) OptIn(ctx context.Context, number string, channel Channel) error {
+	return e.optOuts.RemoveOptOut(ctx, number, string(channel))
+}
@@ -0,0 +1,196 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"claimsio/internal/store"
+)
+
+func newTestEngine(t *testing.T, now string) (*Engine, *store.Memory) {
+	t.Helper()
+
+	at, err := time.Parse(time.RFC3339, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contacts := store.NewMemory()
+	e := NewEngine(DefaultRules, contacts, contacts)
+	e.now = func() time.Time { return at }
+	return e, contacts
+}
+
+func refusal(t *testing.T, err error, code string) *Refusal {
+	t.Helper()
+
+	var r *Refusal
+	if !errors.As(err, &r) {
+		t.Fatalf("got %v want refusal %s", err, code)
+	}
+	if r.Code != code {
+		t.Fatalf("got refusal %s want %s", r.Code, code)
+	}
+	return r
+}
+
+func TestCheckContactHours(t *testing.T) {
+	ctx := context.Background()
+
+	// Wednesday 10:00 in Warsaw
+	e, _ := newTestEngine(t, "2025-01-15T09:00:00Z")
+	if err := e.Check(ctx, "+48732145999", ChannelCall, ""); err != nil {
+		t.Fatalf("unexpected refusal: %v", err)
+	}
+
+	// Wednesday 03:00 in Warsaw, retry at 08:00
+	e, _ = newTestEngine(t, "2025-01-15T02:00:00Z")
+	r := refusal(t, e.Check(ctx, "+48732145999", ChannelCall, ""), CodeOutsideHours)
+	if want := "2025-01-15T07:00:00Z"; r.RetryAfter == nil || r.RetryAfter.Format(time.RFC3339) != want {
+		t.Errorf("retry after %v want %s", r.RetryAfter, want)
+	}
+
+	// Saturday 15:00 in Warsaw, closed until Monday 08:00
+	e, _ = newTestEngine(t, "2025-01-18T14:00:00Z")
+	r = refusal(t, e.Check(ctx, "+48732145999", ChannelSMS, ""), CodeOutsideHours)
+	if want := "2025-01-20T07:00:00Z"; r.RetryAfter == nil || r.RetryAfter.Format(time.RFC3339) != want {
+		t.Errorf("retry after %v want %s", r.RetryAfter, want)
+	}
+
+	// the debtor's own timezone wins over the jurisdiction's
+	e, _ = newTestEngine(t, "2025-01-15T09:00:00Z")
+	refusal(t, e.Check(ctx, "+48732145999", ChannelCall, "America/New_York"), CodeOutsideHours)
+
+	if err := e.Check(ctx, "+48732145999", ChannelCall, "Mars/Olympus"); !errors.Is(err, ErrInvalidTimezone) {
+		t.Errorf("got %v want ErrInvalidTimezone", err)
+	}
+
+	refusal(t, e.Check(ctx, "+14155550100", ChannelCall, ""), CodeUnsupportedJurisdiction)
+}
+
+func TestCheckContactCaps(t *testing.T) {
+	ctx := context.Background()
+
+	// Monday 10:00 in Warsaw
+	e, _ := newTestEngine(t, "2025-01-13T09:00:00Z")
+	if err := e.Record(ctx, "+48732145999", ChannelCall, "CA1"); err != nil {
+		t.Fatal(err)
+	}
+	r := refusal(t, e.Check(ctx, "+48732145999", ChannelCall, ""), CodeDailyCap)
+	if want := "2025-01-14T07:00:00Z"; r.RetryAfter == nil || r.RetryAfter.Format(time.RFC3339) != want {
+		t.Errorf("retry after %v want %s", r.RetryAfter, want)
+	}
+
+	// caps are per channel
+	if err := e.Check(ctx, "+48732145999", ChannelSMS, ""); err != nil {
+		t.Fatalf("unexpected refusal: %v", err)
+	}
+
+	for _, day := range []string{"2025-01-14T09:00:00Z", "2025-01-15T09:00:00Z"} {
+		at, _ := time.Parse(time.RFC3339, day)
+		e.now = func() time.Time { return at }
+		if err := e.Check(ctx, "+48732145999", ChannelCall, ""); err != nil {
+			t.Fatalf("unexpected refusal on %s: %v", day, err)
+		}
+		e.Record(ctx, "+48732145999", ChannelCall, "CA")
+	}
+
+	at, _ := time.Parse(time.RFC3339, "2025-01-16T09:00:00Z")
+	e.now = func() time.Time { return at }
+	r = refusal(t, e.Check(ctx, "+48732145999", ChannelCall, ""), CodeWeeklyCap)
+	if want := "2025-01-20T07:00:00Z"; r.RetryAfter == nil || r.RetryAfter.Format(time.RFC3339) != want {
+		t.Errorf("retry after %v want %s", r.RetryAfter, want)
+	}
+}
+
+func TestConcurrentContactsRespectCaps(t *testing.T) {
+	ctx := context.Background()
+
+	// Monday 10:00 in Warsaw, one call a day
+	e, _ := newTestEngine(t, "2025-01-13T09:00:00Z")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			unlock := e.Lock("+48732145999", ChannelCall)
+			defer unlock()
+
+			if err := e.Check(ctx, "+48732145999", ChannelCall, ""); err != nil {
+				return
+			}
+			// placing the call
+			time.Sleep(time.Millisecond)
+			if err := e.Record(ctx, "+48732145999", ChannelCall, fmt.Sprintf("CA%d", i)); err != nil {
+				t.Error(err)
+			}
+
+			mu.Lock()
+			allowed++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+
+	if allowed != 1 {
+		t.Errorf("%d concurrent calls passed the daily cap of 1", allowed)
+	}
+	if len(e.locks) != 0 {
+		t.Errorf("%d contact locks left behind", len(e.locks))
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules("")
+	if err != nil || rules["PL"].Timezone != "Europe/Warsaw" {
+		t.Fatalf("got %v, %v", rules, err)
+	}
+
+	invalid := Rules{Timezone: "Europe/Prague", Weekdays: &Window{From: "20:00", To: "08:00"}}
+	if err := invalid.validate(); err == nil {
+		t.Error("expected inverted window to be rejected")
+	}
+}
+
+func TestCheckOptOut(t *testing.T) {
+	ctx := context.Background()
+
+	e, _ := newTestEngine(t, "2025-01-15T09:00:00Z")
+	if err := e.OptOut(ctx, "+48732145999", ChannelSMS, "replied STOP", SourceSMSKeyword); err != nil {
+		t.Fatal(err)
+	}
+
+	r := refusal(t, e.Check(ctx, "+48732145999", ChannelSMS, ""), CodeOptedOut)
+	if r.OptOut == nil || r.OptOut.Source != SourceSMSKeyword || r.OptOut.Reason != "replied STOP" {
+		t.Errorf("refusal does not carry the opt-out: %+v", r.OptOut)
+	}
+
+	// other channels stay open
+	if err := e.Check(ctx, "+48732145999", ChannelCall, ""); err != nil {
+		t.Fatalf("unexpected refusal: %v", err)
+	}
+}
+
+func TestParseKeyword(t *testing.T) {
+	for body, want := range map[string]Keyword{
+		"STOP":          KeywordStop,
+		" stop. ":       KeywordStop,
+		"Rezygnuję":     KeywordStop,
+		"start":         KeywordStart,
+		"Help!":         KeywordHelp,
+		"stop calling?": "",
+		"I will pay":    "",
+	} {
+		got, ok := ParseKeyword(body)
+		if got != want || ok != (want != "") {
+			t.Errorf("ParseKeyword(%q) = %q, %v want %q", body, got, ok, want)
+		}
+	}
+}
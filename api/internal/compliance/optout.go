@@ -0,0 +1,61 @@
+package compliance
+
+import "strings"
+
+// Opt-out sources.
+const (
+	SourceSMSKeyword = "sms_keyword"
+	SourceAgent      = "agent"
+)
+
+// Keyword is a reserved SMS reply handled by us rather than passed on as a
+// message.
+type Keyword string
+
+const (
+	KeywordStop  Keyword = "stop"
+	KeywordStart Keyword = "start"
+	KeywordHelp  Keyword = "help"
+)
+
+// smsKeywords are compared after trimming and upper-casing. Twilio's
+// standard keywords plus Polish ones.
+var smsKeywords = map[string]Keyword{
+	"STOP":        KeywordStop,
+	"STOPALL":     KeywordStop,
+	"UNSUBSCRIBE": KeywordStop,
+	"CANCEL":      KeywordStop,
+	"END":         KeywordStop,
+	"QUIT":        KeywordStop,
+	"REZYGNUJE":   KeywordStop,
+	"REZYGNUJĘ":   KeywordStop,
+	"NIE PISAC":   KeywordStop,
+	"NIE PISAĆ":   KeywordStop,
+	"START":       KeywordStart,
+	"UNSTOP":      KeywordStart,
+	"YES":         KeywordStart,
+	"HELP":        KeywordHelp,
+	"INFO":        KeywordHelp,
+	"POMOC":       KeywordHelp,
+}
+
+// ParseKeyword returns the keyword an inbound SMS body consists of, if any.
+func ParseKeyword(body string) (Keyword, bool) {
+	body = strings.Trim(strings.ToUpper(strings.TrimSpace(body)), ".!")
+	keyword, ok := smsKeywords[body]
+	return keyword, ok
+}
+
+// ParseChannels maps the channel named in an opt-out request, "call", "sms"
+// or "all", to the channels it covers.
+func ParseChannels(name string) ([]Channel, bool) {
+	switch Channel(strings.ToLower(strings.TrimSpace(name))) {
+	case ChannelCall:
+		return []Channel{ChannelCall}, true
+	case ChannelSMS:
+		return []Channel{ChannelSMS}, true
+	case "all", "":
+		return []Channel{ChannelCall, ChannelSMS}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,137 @@
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Window is a daily span of permitted contact hours in the debtor's local
+// time, e.g. {"from": "08:00", "to": "20:00"}.
+type Window struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Cap limits contacts on one channel. Zero means no limit.
+type Cap struct {
+	PerDay  int `json:"per_day"`
+	PerWeek int `json:"per_week"`
+}
+
+// Rules are the contact rules of one jurisdiction. Days without a window are
+// closed for contact.
+type Rules struct {
+	// used for debtors whose own timezone is unknown
+	Timezone string          `json:"timezone"`
+	Weekdays *Window         `json:"weekdays,omitempty"`
+	Saturday *Window         `json:"saturday,omitempty"`
+	Sunday   *Window         `json:"sunday,omitempty"`
+	Caps     map[Channel]Cap `json:"caps"`
+}
+
+// DefaultRules apply when no rules file is configured, keyed by ISO country
+// code.
+var DefaultRules = map[string]Rules{
+	"PL": {
+		Timezone: "Europe/Warsaw",
+		Weekdays: &Window{From: "08:00", To: "20:00"},
+		Saturday: &Window{From: "09:00", To: "14:00"},
+		Caps: map[Channel]Cap{
+			ChannelCall: {PerDay: 1, PerWeek: 3},
+			ChannelSMS:  {PerDay: 1, PerWeek: 3},
+		},
+	},
+}
+
+// LoadRules reads per country rules from a JSON file shaped like
+// DefaultRules. Countries in the file replace the defaults, the rest are
+// kept. An empty path returns the defaults.
+func LoadRules(path string) (map[string]Rules, error) {
+	rules := make(map[string]Rules, len(DefaultRules))
+	for country, r := range DefaultRules {
+		rules[country] = r
+	}
+	if path == "" {
+		return rules, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compliance rules: %w", err)
+	}
+	var overrides map[string]Rules
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse compliance rules: %w", err)
+	}
+
+	for country, r := range overrides {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("invalid compliance rules for %s: %w", country, err)
+		}
+		rules[country] = r
+	}
+
+	return rules, nil
+}
+
+func (r Rules) validate() error {
+	if _, err := time.LoadLocation(r.Timezone); err != nil || r.Timezone == "" {
+		return fmt.Errorf("invalid timezone %q", r.Timezone)
+	}
+	for _, w := range []*Window{r.Weekdays, r.Saturday, r.Sunday} {
+		if w == nil {
+			continue
+		}
+		from, errFrom := clock(w.From)
+		to, errTo := clock(w.To)
+		if errFrom != nil || errTo != nil || from >= to {
+			return fmt.Errorf("invalid window %s-%s", w.From, w.To)
+		}
+	}
+	for channel := range r.Caps {
+		if channel != ChannelCall && channel != ChannelSMS {
+			return fmt.Errorf("unknown channel %q", channel)
+		}
+	}
+	return nil
+}
+
+func (r Rules) window(day time.Weekday) *Window {
+	switch day {
+	case time.Saturday:
+		return r.Saturday
+	case time.Sunday:
+		return r.Sunday
+	default:
+		return r.Weekdays
+	}
+}
+
+// bounds returns when the window opens and closes on the day of t.
+func (w *Window) bounds(t time.Time) (time.Time, time.Time) {
+	from, _ := clock(w.From)
+	to, _ := clock(w.To)
+	midnight := startOfDay(t)
+	return midnight.Add(from), midnight.Add(to)
+}
+
+// clock parses "HH:MM" into the time since midnight.
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns Monday midnight of the week of t.
+func startOfWeek(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t).AddDate(0, 0, -offset)
+}
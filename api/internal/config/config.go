@@ -3,37 +3,116 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	Port                string
 	SupabaseServiceRole string
-	SupabasePgURL      string
+	SupabasePgURL       string
 	ElevenLabsAPIKey    string
 	ElevenLabsAgentID   string
+	AgentProvider       string
+	RecordCalls         bool
+	RecordingsDir       string
 	TwilioAccountSID    string
 	TwilioAuthToken     string
 	TwilioPhoneNumber   string
-	N8NAuthToken        string
+	// reject Twilio webhooks without a valid X-Twilio-Signature
+	TwilioValidateSignature bool
+	// messages needing more segments are refused, opt-in: 0, the default,
+	// disables the limit
+	SMSMaxSegments int
+	// replace diacritics so messages fit GSM-7
+	SMSTransliterate bool
+	N8NBaseURL       string
+	N8NAuthToken     string
+	// HMAC key for signing webhook payloads, unsigned when empty
+	N8NWebhookSecret string
+	N8NTimeout       time.Duration
+	// undelivered webhooks are kept here until n8n accepts them
+	N8NOutboxDir string
+	// "postgres" or "memory", memory keeps nothing across restarts
+	Store string
+	// "n8n" or "postgres", where debtors are looked up before a call
+	DebtorResolver string
+	DebtorCacheTTL time.Duration
+	// JSON contact hours and caps per country, built-in rules when empty
+	ComplianceRulesFile string
+	APIKeys             []APIKey
 	Environment         string
 	StripeAPIKeyLive    string
 	StripeAPIKeyTest    string
+	// signing secret of the Stripe webhook endpoint
+	StripeWebhookSecret string
+	// JSON payment profiles per creditor, built-in default profile when empty
+	CreditorProfilesFile string
 }
 
 func Load() (*Config, error) {
 	cfg := &Config{
-		Port:                getEnv("PORT", "8000"),
-		SupabaseServiceRole: getEnv("SUPABASE_SERVICE_ROLE", ""),
-		SupabasePgURL:       getEnv("SUPABASE_PG_URL", ""),
-		ElevenLabsAPIKey:    getEnv("ELEVENLABS_API_KEY", ""),
-		ElevenLabsAgentID:   getEnv("ELEVENLABS_AGENT_ID", ""),
-		TwilioAccountSID:    getEnv("TWILIO_ACCOUNT_SID", ""),
-		TwilioAuthToken:     getEnv("TWILIO_AUTH_TOKEN", ""),
-		TwilioPhoneNumber:   getEnv("TWILIO_PHONE_NUMBER", ""),
-		N8NAuthToken:        getEnv("N8N_AUTH_TOKEN", ""),
-		Environment:         getEnv("ENV", "development"),
-		StripeAPIKeyLive:    getEnv("STRIPE_API_KEY_LIVE", ""),
-		StripeAPIKeyTest:    getEnv("STRIPE_API_KEY_TEST", "sk_test"),
+		Port:                    getEnv("PORT", "8000"),
+		SupabaseServiceRole:     getEnv("SUPABASE_SERVICE_ROLE", ""),
+		SupabasePgURL:           getEnv("SUPABASE_PG_URL", ""),
+		Store:                   getEnv("STORE", "postgres"),
+		ElevenLabsAPIKey:        getEnv("ELEVENLABS_API_KEY", ""),
+		ElevenLabsAgentID:       getEnv("ELEVENLABS_AGENT_ID", ""),
+		AgentProvider:           getEnv("AGENT_PROVIDER", "elevenlabs"),
+		RecordCalls:             getEnv("RECORD_CALLS", "false") == "true",
+		RecordingsDir:           getEnv("RECORDINGS_DIR", "recordings"),
+		TwilioAccountSID:        getEnv("TWILIO_ACCOUNT_SID", ""),
+		TwilioAuthToken:         getEnv("TWILIO_AUTH_TOKEN", ""),
+		TwilioPhoneNumber:       getEnv("TWILIO_PHONE_NUMBER", ""),
+		TwilioValidateSignature: getEnv("TWILIO_VALIDATE_SIGNATURE", "true") == "true",
+		SMSTransliterate:        getEnv("SMS_TRANSLITERATE", "false") == "true",
+		N8NBaseURL:              getEnv("N8N_BASE_URL", "http://app-n8n-1:5678/webhook"),
+		N8NAuthToken:            getEnv("N8N_AUTH_TOKEN", ""),
+		N8NWebhookSecret:        getEnv("N8N_WEBHOOK_SECRET", ""),
+		N8NOutboxDir:            getEnv("N8N_OUTBOX_DIR", "outbox"),
+		DebtorResolver:          getEnv("DEBTOR_RESOLVER", "n8n"),
+		ComplianceRulesFile:     getEnv("COMPLIANCE_RULES_FILE", ""),
+		Environment:             getEnv("ENV", "development"),
+		StripeAPIKeyLive:        getEnv("STRIPE_API_KEY_LIVE", ""),
+		StripeAPIKeyTest:        getEnv("STRIPE_API_KEY_TEST", "sk_test"),
+		StripeWebhookSecret:     getEnv("STRIPE_WEBHOOK_SECRET", ""),
+		CreditorProfilesFile:    getEnv("CREDITOR_PROFILES_FILE", ""),
+	}
+
+	n8nTimeout, err := time.ParseDuration(getEnv("N8N_TIMEOUT", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid N8N_TIMEOUT: %v", err)
+	}
+	cfg.N8NTimeout = n8nTimeout
+
+	smsMaxSegments, err := strconv.Atoi(getEnv("SMS_MAX_SEGMENTS", "0"))
+	if err != nil || smsMaxSegments < 0 {
+		return nil, fmt.Errorf("invalid SMS_MAX_SEGMENTS: %q", getEnv("SMS_MAX_SEGMENTS", "0"))
+	}
+	cfg.SMSMaxSegments = smsMaxSegments
+
+	debtorCacheTTL, err := time.ParseDuration(getEnv("DEBTOR_CACHE_TTL", "5m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DEBTOR_CACHE_TTL: %v", err)
+	}
+	cfg.DebtorCacheTTL = debtorCacheTTL
+
+	apiKeys, err := parseAPIKeys(getEnv("API_KEYS", ""))
+	if err != nil {
+		return nil, err
+	}
+	cfg.APIKeys = apiKeys
+
+	// n8n authenticates with the same token we send to its webhooks. Live
+	// payments are never implied; list the token in API_KEYS with
+	// payments-live to grant them, that entry then replaces this one.
+	if cfg.N8NAuthToken != "" && !hasToken(cfg.APIKeys, cfg.N8NAuthToken) {
+		cfg.APIKeys = append(cfg.APIKeys, APIKey{
+			Name:   "n8n",
+			Token:  cfg.N8NAuthToken,
+			Scopes: []string{ScopeCalls, ScopeSMS, ScopePayments, ScopePrompts},
+		})
 	}
 
 	// Validate required environment variables
@@ -56,6 +135,26 @@ func (c *Config) validate() error {
 		}
 	}
 
+	switch c.Store {
+	case "memory":
+	case "postgres":
+		if c.SupabasePgURL == "" {
+			return fmt.Errorf("SUPABASE_PG_URL is required unless STORE=memory")
+		}
+	default:
+		return fmt.Errorf("invalid STORE %q: expected postgres or memory", c.Store)
+	}
+
+	switch c.DebtorResolver {
+	case "n8n":
+	case "postgres":
+		if c.SupabasePgURL == "" {
+			return fmt.Errorf("DEBTOR_RESOLVER=postgres requires SUPABASE_PG_URL")
+		}
+	default:
+		return fmt.Errorf("invalid DEBTOR_RESOLVER %q: expected n8n or postgres", c.DebtorResolver)
+	}
+
 	return nil
 }
 
@@ -65,3 +164,71 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+// API key scopes, one per group of control endpoints
+const (
+	ScopeAll      = "*"
+	ScopeCalls    = "calls"
+	ScopeSMS      = "sms"
+	ScopePayments = "payments"
+	ScopePrompts  = "prompts"
+	// grants payments against the live Stripe account instead of test mode,
+	// only when listed by name: "*" does not include it
+	ScopePaymentsLive = "payments-live"
+)
+
+// APIKey is a named bearer token allowed to call the routes in its scopes.
+type APIKey struct {
+	Name   string
+	Token  string
+	Scopes []string
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAll && scope != ScopePaymentsLive {
+			return true
+		}
+	}
+	return false
+}
+
+func hasToken(keys []APIKey, token string) bool {
+	for _, key := range keys {
+		if key.Token == token {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAPIKeys reads API_KEYS, a semicolon separated list of
+// name:token:scope,scope entries, e.g.
+// "admin:secret1:*;debtor-panel:secret2:payments".
+func parseAPIKeys(value string) ([]APIKey, error) {
+	var keys []APIKey
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid API_KEYS entry %q: expected name:token:scopes", parts[0])
+		}
+
+		key := APIKey{Name: parts[0], Token: parts[1]}
+		for _, scope := range strings.Split(parts[2], ",") {
+			switch scope = strings.TrimSpace(scope); scope {
+			case ScopeAll, ScopeCalls, ScopeSMS, ScopePayments, ScopePaymentsLive, ScopePrompts:
+				key.Scopes = append(key.Scopes, scope)
+			default:
+				return nil, fmt.Errorf("invalid API_KEYS entry %q: unknown scope %q", key.Name, scope)
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,87 @@
+package debtor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	phonenumber "claimsio/internal/phone"
+)
+
+// Cached keeps resolved debtors for a TTL, keyed by the E.164 form of the
+// phone number. Unknown numbers and lookup errors are not cached, so a newly
+// added debtor is found on their next call. Expired entries are swept at most
+// once per TTL, so the map only holds numbers seen recently.
+type Cached struct {
+	next Resolver
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	nextSweep time.Time
+}
+
+type cacheEntry struct {
+	record    Record
+	expiresAt time.Time
+}
+
+func NewCached(next Resolver, ttl time.Duration) *Cached {
+	return &Cached{
+		next:    next,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *Cached) Resolve(ctx context.Context, phone string) (Record, error) {
+	key, err := phonenumber.Normalize(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && c.now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		return entry.record, nil
+	}
+
+	record, err := c.next.Resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	now := c.now()
+	if now.After(c.nextSweep) {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[key] = cacheEntry{record: record, expiresAt: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	return record, nil
+}
+
+// Forget drops the cached debtor for phone, e.g. after their data changed.
+func (c *Cached) Forget(phone string) {
+	key, err := phonenumber.Normalize(phone)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
@@ -0,0 +1,96 @@
+package debtor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"claimsio/internal/phone"
+)
+
+type countingResolver struct {
+	records map[string]Record
+	calls   []string
+}
+
+func (r *countingResolver) Resolve(ctx context.Context, phone string) (Record, error) {
+	r.calls = append(r.calls, phone)
+	record, ok := r.records[phone]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+func TestCached(t *testing.T) {
+	next := &countingResolver{records: map[string]Record{
+		"+48500100200": {"debtor_id": "d1"},
+	}}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewCached(next, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for _, number := range []string{"+48500100200", "+48 500-100-200", "500100200"} {
+		record, err := cache.Resolve(ctx, number)
+		if err != nil || record["debtor_id"] != "d1" {
+			t.Fatalf("Resolve(%q) = %v, %v", number, record, err)
+		}
+	}
+	if len(next.calls) != 1 {
+		t.Errorf("got %d lookups want 1", len(next.calls))
+	}
+
+	// unknown numbers are looked up every time
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Resolve(ctx, "+48600000000"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v want ErrNotFound", err)
+		}
+	}
+	if len(next.calls) != 3 {
+		t.Errorf("got %d lookups want 3", len(next.calls))
+	}
+
+	// invalid numbers never reach the resolver
+	if _, err := cache.Resolve(ctx, "anonymous"); !errors.Is(err, phone.ErrInvalid) {
+		t.Fatalf("got %v want phone.ErrInvalid", err)
+	}
+	if len(next.calls) != 3 {
+		t.Errorf("got %d lookups want 3", len(next.calls))
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.Resolve(ctx, "+48500100200"); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.calls) != 4 {
+		t.Errorf("expired entry was not looked up again, got %d lookups", len(next.calls))
+	}
+}
+
+func TestCachedSweepsExpiredEntries(t *testing.T) {
+	next := &countingResolver{records: map[string]Record{
+		"+48500100200": {"debtor_id": "d1"},
+		"+48500100201": {"debtor_id": "d2"},
+		"+48500100202": {"debtor_id": "d3"},
+	}}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewCached(next, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for _, number := range []string{"+48500100200", "+48500100201"} {
+		if _, err := cache.Resolve(ctx, number); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.Resolve(ctx, "+48500100202"); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.entries) != 1 {
+		t.Errorf("got %d cached entries want 1", len(cache.entries))
+	}
+}
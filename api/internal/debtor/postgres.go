@@ -0,0 +1,72 @@
+package debtor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	phonenumber "claimsio/internal/phone"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// phoneDigits reduces the stored phone to its digits without an international
+// "00" prefix, the form debtors_phone_digits_idx (migration 0013) indexes.
+const phoneDigits = "regexp_replace(regexp_replace(d.phone, '[^0-9]', '', 'g'), '^00', '')"
+
+// Postgres reads debtors straight from the Supabase tables maintained by the
+// admin panel, so calls can be answered while n8n is down.
+type Postgres struct {
+	sb sq.StatementBuilderType
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{sb: sq.StatementBuilder.PlaceholderFormat(sq.Dollar).RunWith(db)}
+}
+
+// Resolve returns the debtor with the given phone and their most recent case.
+// The debtors and cases tables are owned by the admin panel, which stores
+// phones as typed, so both sides are compared as bare digits.
+func (p *Postgres) Resolve(ctx context.Context, phone string) (Record, error) {
+	phone, err := phonenumber.Normalize(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	var debtorID, firstName, lastName string
+	var caseID, caseNumber sql.NullString
+
+	err = p.sb.Select("d.id", "d.first_name", "d.last_name", "c.id", "c.case_number").
+		From("debtors d").
+		LeftJoin("cases c ON c.debtor_id = d.id").
+		Where(sq.Expr(phoneDigits+" = ?", strings.TrimPrefix(phone, "+"))).
+		OrderBy("c.created_at DESC NULLS LAST").
+		Limit(1).
+		QueryRowContext(ctx).
+		Scan(&debtorID, &firstName, &lastName, &caseID, &caseNumber)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := Record{
+		"debtor_id": debtorID,
+		"debtor": map[string]interface{}{
+			"id":         debtorID,
+			"first_name": firstName,
+			"last_name":  lastName,
+			"phone":      phone,
+		},
+	}
+	if caseID.Valid {
+		record["case"] = map[string]interface{}{
+			"id":          caseID.String,
+			"case_number": caseNumber.String,
+		}
+	}
+
+	return record, nil
+}
@@ -0,0 +1,42 @@
+// Package debtor finds the debtor behind a phone number before a call is
+// connected.
+package debtor
+
+import (
+	"context"
+	"errors"
+
+	"claimsio/internal/n8n"
+)
+
+var ErrNotFound = errors.New("debtor not found")
+
+// Record is the debtor context handed to the agent, in the shape n8n's
+// check-user webhook returns: debtor_id plus the debtor and case objects.
+type Record map[string]interface{}
+
+// Resolver looks up the debtor registered for a phone number. It returns
+// ErrNotFound for unknown numbers.
+type Resolver interface {
+	Resolve(ctx context.Context, phone string) (Record, error)
+}
+
+// N8N resolves debtors through the n8n check-user webhook.
+type N8N struct {
+	Client *n8n.Client
+}
+
+func NewN8N(client *n8n.Client) *N8N {
+	return &N8N{Client: client}
+}
+
+func (r *N8N) Resolve(ctx context.Context, phone string) (Record, error) {
+	userData, err := r.Client.CheckUser(ctx, phone)
+	if errors.Is(err, n8n.ErrUnknownDebtor) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Record(userData), nil
+}
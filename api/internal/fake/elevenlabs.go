@@ -0,0 +1,218 @@
+// Package fake provides in-process stand-ins for the external services a call
+// talks to, so media streams can be exercised under go test without network.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"claimsio/internal/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// ElevenLabs is a fake ConvAI server. Every conversation it accepts sends
+// conversation_initiation_metadata, the configured audio chunks, the agent
+// response and user transcript, any tool calls, a ping and an interruption,
+// then records what the client sends back.
+type ElevenLabs struct {
+	APIKey         string
+	ConversationID string
+	AudioChunks    []string
+	AgentResponse  string
+	UserTranscript string
+	PingEventID    int64
+	ToolCalls      []protocol.ClientToolCall
+
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu          sync.Mutex
+	initiations []protocol.ConversationInitiationClientData
+	userAudio   []string
+	pongs       []int64
+	toolResults []protocol.ClientToolResult
+	ended       int
+}
+
+func NewElevenLabs() *ElevenLabs {
+	f := &ElevenLabs{
+		APIKey:         "xi_test_key",
+		ConversationID: "conv_fake_1",
+		AudioChunks:    []string{"YWdlbnQtMQ==", "YWdlbnQtMg=="},
+		AgentResponse:  "Hello, do you have a moment to talk?",
+		UserTranscript: "Yes, I do.",
+		PingEventID:    1,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/convai/conversation/get_signed_url", f.handleSignedURL)
+	mux.HandleFunc("/v1/convai/conversation", f.handleConversation)
+	f.server = httptest.NewServer(mux)
+
+	return f
+}
+
+// URL is the base URL to use in place of https://api.elevenlabs.io.
+func (f *ElevenLabs) URL() string {
+	return f.server.URL
+}
+
+func (f *ElevenLabs) Close() {
+	f.server.Close()
+}
+
+func (f *ElevenLabs) handleSignedURL(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("xi-api-key") != f.APIKey {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return
+	}
+
+	agentID := r.URL.Query().Get("agent_id")
+	if agentID == "" {
+		http.Error(w, "agent_id is required", http.StatusBadRequest)
+		return
+	}
+
+	signedURL := fmt.Sprintf("ws%s/v1/convai/conversation?agent_id=%s&conversation_signature=fake",
+		strings.TrimPrefix(f.server.URL, "http"), agentID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"signed_url": signedURL})
+}
+
+func (f *ElevenLabs) handleConversation(w http.ResponseWriter, r *http.Request) {
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var initiation protocol.ConversationInitiationClientData
+	if err := conn.ReadJSON(&initiation); err != nil {
+		return
+	}
+	f.mu.Lock()
+	f.initiations = append(f.initiations, initiation)
+	f.mu.Unlock()
+
+	script := []interface{}{
+		map[string]interface{}{
+			"type": protocol.ElevenLabsConversationInitiationMetadata,
+			"conversation_initiation_metadata_event": protocol.ConversationInitiationMetadata{
+				ConversationID:         f.ConversationID,
+				AgentOutputAudioFormat: "ulaw_8000",
+				UserInputAudioFormat:   "ulaw_8000",
+			},
+		},
+	}
+	for i, chunk := range f.AudioChunks {
+		script = append(script, map[string]interface{}{
+			"type":        protocol.ElevenLabsAudio,
+			"audio_event": protocol.AudioEvent{AudioBase64: chunk, EventID: int64(i + 1)},
+		})
+	}
+	if f.AgentResponse != "" {
+		script = append(script, map[string]interface{}{
+			"type":                 protocol.ElevenLabsAgentResponse,
+			"agent_response_event": protocol.AgentResponseEvent{AgentResponse: f.AgentResponse},
+		})
+	}
+	if f.UserTranscript != "" {
+		script = append(script, map[string]interface{}{
+			"type":                     protocol.ElevenLabsUserTranscript,
+			"user_transcription_event": protocol.UserTranscriptEvent{UserTranscript: f.UserTranscript},
+		})
+	}
+	for _, call := range f.ToolCalls {
+		script = append(script, map[string]interface{}{
+			"type":             protocol.ElevenLabsClientToolCall,
+			"client_tool_call": call,
+		})
+	}
+	script = append(script,
+		map[string]interface{}{
+			"type":       protocol.ElevenLabsPing,
+			"ping_event": protocol.PingEvent{EventID: f.PingEventID},
+		},
+		map[string]interface{}{
+			"type":               protocol.ElevenLabsInterruption,
+			"interruption_event": protocol.InterruptionEvent{EventID: int64(len(f.AudioChunks) + 1)},
+		},
+	)
+
+	for _, msg := range script {
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg struct {
+			Type           string `json:"type"`
+			EventID        int64  `json:"event_id"`
+			UserAudioChunk string `json:"user_audio_chunk"`
+			protocol.ClientToolResult
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		f.mu.Lock()
+		switch {
+		case msg.UserAudioChunk != "":
+			f.userAudio = append(f.userAudio, msg.UserAudioChunk)
+		case msg.Type == protocol.ElevenLabsPong:
+			f.pongs = append(f.pongs, msg.EventID)
+		case msg.Type == protocol.ElevenLabsEndConversation:
+			f.ended++
+		case msg.Type == protocol.ElevenLabsClientToolResult:
+			f.toolResults = append(f.toolResults, msg.ClientToolResult)
+		}
+		f.mu.Unlock()
+	}
+}
+
+// Initiations returns the client data sent at the start of each conversation.
+func (f *ElevenLabs) Initiations() []protocol.ConversationInitiationClientData {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]protocol.ConversationInitiationClientData(nil), f.initiations...)
+}
+
+// UserAudio returns the caller audio chunks received across conversations.
+func (f *ElevenLabs) UserAudio() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.userAudio...)
+}
+
+// Pongs returns the event ids of received pong messages.
+func (f *ElevenLabs) Pongs() []int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int64(nil), f.pongs...)
+}
+
+// ToolResults returns the client tool results received across conversations.
+func (f *ElevenLabs) ToolResults() []protocol.ClientToolResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]protocol.ClientToolResult(nil), f.toolResults...)
+}
+
+// Ended reports how many conversations the client ended explicitly.
+func (f *ElevenLabs) Ended() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ended
+}
@@ -0,0 +1,86 @@
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// N8N is a fake n8n webhook server. It answers check-user lookups from
+// Debtors and records every other webhook it receives.
+type N8N struct {
+	// debtor records keyed by phone number
+	Debtors map[string]map[string]interface{}
+
+	server *httptest.Server
+
+	mu       sync.Mutex
+	webhooks []Webhook
+}
+
+type Webhook struct {
+	Endpoint      string
+	Authorization string
+	Payload       map[string]interface{}
+}
+
+func NewN8N() *N8N {
+	f := &N8N{Debtors: make(map[string]map[string]interface{})}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+// URL is the webhook base url, the equivalent of http://app-n8n-1:5678/webhook.
+func (f *N8N) URL() string {
+	return f.server.URL + "/webhook"
+}
+
+func (f *N8N) Close() {
+	f.server.Close()
+}
+
+func (f *N8N) handle(w http.ResponseWriter, r *http.Request) {
+	endpoint := strings.TrimPrefix(r.URL.Path, "/webhook/")
+
+	var payload map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&payload)
+
+	if endpoint == "check-user" {
+		phone, _ := payload["phone"].(string)
+		debtor, ok := f.Debtors[phone]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(debtor)
+		return
+	}
+
+	f.mu.Lock()
+	f.webhooks = append(f.webhooks, Webhook{
+		Endpoint:      endpoint,
+		Authorization: r.Header.Get("Authorization"),
+		Payload:       payload,
+	})
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Webhooks returns the webhooks received so far, optionally filtered by
+// endpoint.
+func (f *N8N) Webhooks(endpoint string) []Webhook {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var matched []Webhook
+	for _, hook := range f.webhooks {
+		if endpoint == "" || hook.Endpoint == endpoint {
+			matched = append(matched, hook)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,184 @@
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"claimsio/internal/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// TwilioStream plays the Twilio side of a media stream websocket.
+type TwilioStream struct {
+	AccountSid string
+	CallSid    string
+	StreamSid  string
+
+	conn     *websocket.Conn
+	writeMu  sync.Mutex
+	sequence int
+
+	mu     sync.Mutex
+	frames []protocol.TwilioOutbound
+	closed chan struct{}
+}
+
+// DialTwilio opens a media stream against url (ws://...).
+func DialTwilio(url string, header http.Header) (*TwilioStream, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TwilioStream{
+		AccountSid: "AC00000000000000000000000000000000",
+		CallSid:    "CA00000000000000000000000000000001",
+		StreamSid:  "MZ00000000000000000000000000000001",
+		conn:       conn,
+		closed:     make(chan struct{}),
+	}
+	go s.read()
+
+	return s, nil
+}
+
+func (s *TwilioStream) read() {
+	defer close(s.closed)
+
+	for {
+		var frame protocol.TwilioOutbound
+		if err := s.conn.ReadJSON(&frame); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.frames = append(s.frames, frame)
+		s.mu.Unlock()
+	}
+}
+
+func (s *TwilioStream) send(msg protocol.TwilioMessage) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.sequence++
+	msg.SequenceNumber = strconv.Itoa(s.sequence)
+	return s.conn.WriteJSON(msg)
+}
+
+// Start sends the connected and start events with the given custom
+// parameters, as Twilio does when a <Stream> begins.
+func (s *TwilioStream) Start(customParameters map[string]string) error {
+	if err := s.send(protocol.TwilioMessage{
+		Event:    protocol.TwilioEventConnected,
+		Protocol: "Call",
+		Version:  "1.0.0",
+	}); err != nil {
+		return err
+	}
+
+	return s.send(protocol.TwilioMessage{
+		Event:     protocol.TwilioEventStart,
+		StreamSid: s.StreamSid,
+		Start: &protocol.TwilioStart{
+			AccountSid:       s.AccountSid,
+			StreamSid:        s.StreamSid,
+			CallSid:          s.CallSid,
+			Tracks:           []string{"inbound"},
+			CustomParameters: customParameters,
+			MediaFormat: protocol.TwilioMediaFormat{
+				Encoding:   "audio/x-mulaw",
+				SampleRate: 8000,
+				Channels:   1,
+			},
+		},
+	})
+}
+
+// SendMedia sends a chunk of caller audio.
+func (s *TwilioStream) SendMedia(payload string) error {
+	return s.send(protocol.TwilioMessage{
+		Event:     protocol.TwilioEventMedia,
+		StreamSid: s.StreamSid,
+		Media: &protocol.TwilioMedia{
+			Track:   "inbound",
+			Payload: payload,
+		},
+	})
+}
+
+// Stop sends the stop event Twilio emits on hang-up.
+func (s *TwilioStream) Stop() error {
+	return s.send(protocol.TwilioMessage{
+		Event:     protocol.TwilioEventStop,
+		StreamSid: s.StreamSid,
+		Stop: &protocol.TwilioStop{
+			AccountSid: s.AccountSid,
+			CallSid:    s.CallSid,
+		},
+	})
+}
+
+// Close drops the socket without a stop event, like a network failure.
+func (s *TwilioStream) Close() error {
+	return s.conn.Close()
+}
+
+// Frames returns every frame the server has sent so far.
+func (s *TwilioStream) Frames() []protocol.TwilioOutbound {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]protocol.TwilioOutbound(nil), s.frames...)
+}
+
+// WaitForFrames blocks until at least n frames with the given event have
+// arrived.
+func (s *TwilioStream) WaitForFrames(event string, n int, timeout time.Duration) ([]protocol.TwilioOutbound, error) {
+	deadline := time.After(timeout)
+	for {
+		// check before counting so frames read just ahead of the close
+		// are not missed
+		closed := s.isClosed()
+
+		var matched []protocol.TwilioOutbound
+		for _, frame := range s.Frames() {
+			if frame.Event == event {
+				matched = append(matched, frame)
+			}
+		}
+		if len(matched) >= n {
+			return matched, nil
+		}
+		if closed {
+			return matched, fmt.Errorf("stream closed after %d %s frames, want %d", len(matched), event, n)
+		}
+
+		select {
+		case <-deadline:
+			return matched, fmt.Errorf("got %d %s frames, want %d", len(matched), event, n)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (s *TwilioStream) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitClosed blocks until the server closes the socket.
+func (s *TwilioStream) WaitClosed(timeout time.Duration) error {
+	select {
+	case <-s.closed:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("stream still open after %s", timeout)
+	}
+}
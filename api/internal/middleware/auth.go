@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"claimsio/internal/config"
+)
+
+type apiKeyContextKey struct{}
+
+// RequireAPIKey rejects requests without a bearer token belonging to one of
+// keys. The key must also be granted scope, otherwise the request is
+// forbidden. The matched key is stored on the request context.
+func RequireAPIKey(keys []config.APIKey, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="claimsio"`)
+			http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		key, ok := matchAPIKey(keys, token)
+		if !ok {
+			log.Printf("rejected request with unknown API key: %s %s", r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="claimsio", error="invalid_token"`)
+			http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		if !key.HasScope(scope) {
+			log.Printf("API key %s is not allowed to access %s %s", key.Name, r.Method, r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	})
+}
+
+// APIKeyFromContext returns the key that authenticated the request.
+func APIKeyFromContext(ctx context.Context) (config.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(config.APIKey)
+	return key, ok
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// matchAPIKey compares the token against every key in constant time. Hashing
+// first keeps the comparison independent of the token lengths.
+func matchAPIKey(keys []config.APIKey, token string) (config.APIKey, bool) {
+	sum := sha256.Sum256([]byte(token))
+
+	var match config.APIKey
+	found := 0
+	for _, key := range keys {
+		keySum := sha256.Sum256([]byte(key.Token))
+		if subtle.ConstantTimeCompare(sum[:], keySum[:]) == 1 && key.Token != "" {
+			match = key
+			found = 1
+		}
+	}
+
+	return match, found == 1
+}
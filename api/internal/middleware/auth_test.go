@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"claimsio/internal/config"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	keys := []config.APIKey{
+		{Name: "n8n", Token: "n8n-token", Scopes: []string{config.ScopeCalls, config.ScopeSMS}},
+		{Name: "admin", Token: "admin-token", Scopes: []string{config.ScopeAll}},
+		{Name: "debtor-panel", Token: "panel-token", Scopes: []string{config.ScopePayments}},
+	}
+
+	var caller string
+	handler := RequireAPIKey(keys, config.ScopeCalls, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := APIKeyFromContext(r.Context())
+		caller = key.Name
+	}))
+
+	cases := []struct {
+		name   string
+		header string
+		want   int
+		caller string
+	}{
+		{"n8n", "Bearer n8n-token", http.StatusOK, "n8n"},
+		{"admin wildcard", "Bearer admin-token", http.StatusOK, "admin"},
+		{"lowercase scheme", "bearer n8n-token", http.StatusOK, "n8n"},
+		{"out of scope", "Bearer panel-token", http.StatusForbidden, ""},
+		{"unknown token", "Bearer nope", http.StatusUnauthorized, ""},
+		{"raw token", "n8n-token", http.StatusUnauthorized, ""},
+		{"missing", "", http.StatusUnauthorized, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			caller = ""
+			req := httptest.NewRequest(http.MethodGet, "/calls", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.want {
+				t.Errorf("got status %d want %d", rr.Code, tc.want)
+			}
+			if caller != tc.caller {
+				t.Errorf("got caller %q want %q", caller, tc.caller)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKeyIgnoresEmptyTokens(t *testing.T) {
+	keys := []config.APIKey{{Name: "broken", Token: "", Scopes: []string{config.ScopeAll}}}
+	handler := RequireAPIKey(keys, config.ScopeCalls, okHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/calls", nil)
+	req.Header.Set("Authorization", "Bearer ")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
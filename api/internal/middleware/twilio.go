@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/twilio/twilio-go/client"
+)
+
+// TwilioSignature rejects requests that do not carry a valid
+// X-Twilio-Signature for authToken. It covers form-posted webhooks and the
+// media stream websocket upgrade, which Twilio signs with the wss:// url.
+func TwilioSignature(authToken string, next http.Handler) http.Handler {
+	validator := client.NewRequestValidator(authToken)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature := r.Header.Get("X-Twilio-Signature")
+		if signature == "" {
+			http.Error(w, "Missing Twilio signature", http.StatusForbidden)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+
+		// only POST body parameters are signed, query parameters are part
+		// of the url
+		params := make(map[string]string, len(r.PostForm))
+		for key := range r.PostForm {
+			params[key] = r.PostForm.Get(key)
+		}
+
+		if !validator.Validate(twilioRequestURL(r), params, signature) {
+			log.Printf("rejected request with invalid Twilio signature: %s %s", r.Method, r.RequestURI)
+			http.Error(w, "Invalid Twilio signature", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// twilioRequestURL rebuilds the public url Twilio requested. TLS is
+// terminated in front of the service, so https is assumed unless the proxy
+// says otherwise.
+func twilioRequestURL(r *http.Request) string {
+	scheme := "https"
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		scheme = "wss"
+		if r.Header.Get("X-Forwarded-Proto") == "http" {
+			scheme = "ws"
+		}
+	}
+
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// signature vector published with the Twilio helper libraries
+const (
+	vectorAuthToken = "12345"
+	vectorURL       = "https://mycompany.com/myapp.php?foo=1&bar=2"
+	vectorSignature = "vOEb5UThFn24KEfnOFLQY2AE5FY="
+)
+
+var vectorParams = url.Values{
+	"Digits":                {"1234"},
+	"CallSid":               {"CA1234567890ABCDE"},
+	"To":                    {"+18005551212"},
+	"Caller":                {"+14158675309"},
+	"From":                  {"+14158675309"},
+	"ReasonConferenceEnded": {"test"},
+	"Reason":                {"Participant"},
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestTwilioSignatureForm(t *testing.T) {
+	handler := TwilioSignature(vectorAuthToken, okHandler())
+
+	cases := []struct {
+		name      string
+		signature string
+		body      url.Values
+		want      int
+	}{
+		{"valid", vectorSignature, vectorParams, http.StatusOK},
+		{"missing", "", vectorParams, http.StatusForbidden},
+		{"forged", "WRONG+SIGNATURE=", vectorParams, http.StatusForbidden},
+		{"tampered body", vectorSignature, url.Values{"From": {"+48000000000"}}, http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// served over plain http behind a TLS terminating proxy
+			req := httptest.NewRequest(http.MethodPost, "http://mycompany.com/myapp.php?foo=1&bar=2",
+				strings.NewReader(tc.body.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.signature != "" {
+				req.Header.Set("X-Twilio-Signature", tc.signature)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.want {
+				t.Errorf("got status %d want %d", rr.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestTwilioSignatureWebsocketUpgrade(t *testing.T) {
+	// the media stream upgrade is signed with the wss:// <Stream> url
+	mac := hmac.New(sha1.New, []byte(vectorAuthToken))
+	mac.Write([]byte("wss://mycompany.com/media-stream"))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	handler := TwilioSignature(vectorAuthToken, okHandler())
+
+	for _, tc := range []struct {
+		signature string
+		want      int
+	}{
+		{signature, http.StatusOK},
+		{vectorSignature, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://mycompany.com/media-stream", nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("X-Twilio-Signature", tc.signature)
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tc.want {
+			t.Errorf("signature %s: got status %d want %d", tc.signature, rr.Code, tc.want)
+		}
+	}
+}
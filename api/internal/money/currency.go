@@ -0,0 +1,66 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownCurrency is returned for codes missing from the currency table.
+var ErrUnknownCurrency = errors.New("money: unknown currency")
+
+// Currency is an ISO 4217 currency. Exponent is the number of minor unit
+// digits, e.g. 2 for PLN (1 zł = 100 gr) and 0 for JPY.
+type Currency struct {
+	Code     string
+	Exponent int
+	// Symbol is the local symbol, e.g. "zł" or "€"
+	Symbol string
+	// International marks symbols understood outside the home country, used
+	// in front of the amount in English ("€12.50")
+	International bool
+	// Locale formats amounts when no other locale is given
+	Locale string
+}
+
+// currencies are the currencies debts may be collected in.
+var currencies = map[string]Currency{
+	"PLN": {Code: "PLN", Exponent: 2, Symbol: "zł", Locale: "pl"},
+	"EUR": {Code: "EUR", Exponent: 2, Symbol: "€", International: true, Locale: "en"},
+	"USD": {Code: "USD", Exponent: 2, Symbol: "$", International: true, Locale: "en"},
+	"GBP": {Code: "GBP", Exponent: 2, Symbol: "£", International: true, Locale: "en"},
+	"CZK": {Code: "CZK", Exponent: 2, Symbol: "Kč", Locale: "cs"},
+	"CHF": {Code: "CHF", Exponent: 2, Symbol: "CHF", Locale: "de"},
+	"UAH": {Code: "UAH", Exponent: 2, Symbol: "₴", Locale: "uk"},
+	"HUF": {Code: "HUF", Exponent: 2, Symbol: "Ft", Locale: "en"},
+	"RON": {Code: "RON", Exponent: 2, Symbol: "lei", Locale: "en"},
+	"SEK": {Code: "SEK", Exponent: 2, Symbol: "kr", Locale: "en"},
+	"NOK": {Code: "NOK", Exponent: 2, Symbol: "kr", Locale: "en"},
+	"DKK": {Code: "DKK", Exponent: 2, Symbol: "kr", Locale: "en"},
+	"JPY": {Code: "JPY", Exponent: 0, Symbol: "¥", International: true, Locale: "en"},
+	"KRW": {Code: "KRW", Exponent: 0, Symbol: "₩", Locale: "en"},
+	"BHD": {Code: "BHD", Exponent: 3, Symbol: "BHD", Locale: "en"},
+	"KWD": {Code: "KWD", Exponent: 3, Symbol: "KWD", Locale: "en"},
+}
+
+// LookupCurrency returns the currency with the given code in any case.
+func LookupCurrency(code string) (Currency, error) {
+	c, ok := currencies[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return Currency{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+	return c, nil
+}
+
+// StripeCode is the lowercase code Stripe expects.
+func (c Currency) StripeCode() string {
+	return strings.ToLower(c.Code)
+}
+
+func (c Currency) factor() int64 {
+	f := int64(1)
+	for i := 0; i < c.Exponent; i++ {
+		f *= 10
+	}
+	return f
+}
@@ -0,0 +1,78 @@
+package money
+
+import (
+	"strconv"
+	"strings"
+)
+
+type locale struct {
+	decimal string
+	group   string
+	// symbolFirst puts international symbols in front of the amount
+	symbolFirst bool
+}
+
+// locales are the languages debtors are contacted in, keyed by ISO 639-1
+// code.
+var locales = map[string]locale{
+	"en": {decimal: ".", group: ",", symbolFirst: true},
+	"pl": {decimal: ",", group: " "},
+	"cs": {decimal: ",", group: " "},
+	"sk": {decimal: ",", group: " "},
+	"de": {decimal: ",", group: "."},
+	"lt": {decimal: ",", group: " "},
+	"uk": {decimal: ",", group: " "},
+}
+
+// Format renders m for speakers of lang, an ISO 639-1 code optionally
+// followed by a region ("pl", "en-GB"): "150,00 zł" in Polish, "€12.50" or
+// "PLN 150.00" in English. Unknown languages use the currency's home locale.
+func (m Money) Format(lang string) string {
+	lang, _, _ = strings.Cut(strings.ToLower(strings.ReplaceAll(lang, "_", "-")), "-")
+	loc, ok := locales[lang]
+	if !ok {
+		lang = m.Currency.Locale
+		loc = locales[lang]
+	}
+
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	factor := m.Currency.factor()
+	number := group(strconv.FormatInt(amount/factor, 10), loc.group)
+	if m.Currency.Exponent > 0 {
+		frac := strconv.FormatInt(amount%factor, 10)
+		number += loc.decimal + strings.Repeat("0", m.Currency.Exponent-len(frac)) + frac
+	}
+
+	// local symbols are only used at home, elsewhere the code is clearer
+	symbol := m.Currency.Code
+	if m.Currency.International || m.Currency.Locale == lang {
+		symbol = m.Currency.Symbol
+	}
+
+	switch {
+	case loc.symbolFirst && m.Currency.International:
+		return sign + symbol + number
+	case loc.symbolFirst:
+		return sign + symbol + " " + number
+	default:
+		return sign + number + " " + symbol
+	}
+}
+
+// group inserts sep between thousands.
+func group(digits, sep string) string {
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString(sep)
+		}
+		b.WriteRune(d)
+	}
+	return b.String()
+}
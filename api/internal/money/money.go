@@ -0,0 +1,91 @@
+// Package money represents amounts as integers in the minor unit of their
+// currency, so debts are never rounded through floating point.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrInvalidAmount is returned by Parse for malformed amounts or amounts with
+// more decimals than the currency has.
+var ErrInvalidAmount = errors.New("money: invalid amount")
+
+// Money is an amount in the minor unit of Currency, e.g. 15000 PLN is
+// 150,00 zł.
+type Money struct {
+	Amount   int64
+	Currency Currency
+}
+
+// New returns amount minor units of the currency with the given code.
+func New(amount int64, code string) (Money, error) {
+	c, err := LookupCurrency(code)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: amount, Currency: c}, nil
+}
+
+// Parse reads a decimal amount in major units, e.g. "150.5" PLN is 15050.
+// Both "." and "," are accepted as the decimal separator.
+func Parse(value, code string) (Money, error) {
+	c, err := LookupCurrency(code)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s := strings.TrimSpace(value)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(strings.Replace(s, ",", ".", 1), ".")
+	frac = strings.TrimRight(frac, "0")
+	if whole == "" || !digits(whole) || !digits(frac) || len(frac) > c.Exponent {
+		return Money{}, fmt.Errorf("%w: %q in %s", ErrInvalidAmount, value, c.Code)
+	}
+	frac += strings.Repeat("0", c.Exponent-len(frac))
+
+	var amount int64
+	for _, d := range whole + frac {
+		if amount > (math.MaxInt64-9)/10 {
+			return Money{}, fmt.Errorf("%w: %q is too large", ErrInvalidAmount, value)
+		}
+		amount = amount*10 + int64(d-'0')
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: c}, nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Split divides m into n parts differing by at most one minor unit. The
+// first parts carry the remainder, e.g. 100,00 zł in 3 is 33,34 zł, 33,33 zł
+// and 33,33 zł.
+func (m Money) Split(n int) []Money {
+	parts := make([]Money, n)
+	for i := range parts {
+		parts[i] = Money{Amount: m.Amount / int64(n), Currency: m.Currency}
+		if int64(i) < m.Amount%int64(n) {
+			parts[i].Amount++
+		}
+	}
+	return parts
+}
+
+// String formats m in the home locale of its currency.
+func (m Money) String() string {
+	return m.Format(m.Currency.Locale)
+}
@@ -0,0 +1,91 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value, code string
+		want        int64
+		err         error
+	}{
+		{value: "150", code: "PLN", want: 15000},
+		{value: "150.5", code: "pln", want: 15050},
+		{value: "100,50", code: "PLN", want: 10050},
+		{value: "0.07", code: "EUR", want: 7},
+		{value: "12.500", code: "EUR", want: 1250},
+		{value: "1500", code: "JPY", want: 1500},
+		{value: "1.234", code: "KWD", want: 1234},
+		{value: "-3.10", code: "USD", want: -310},
+		{value: "10.005", code: "PLN", err: ErrInvalidAmount},
+		{value: "10.5", code: "JPY", err: ErrInvalidAmount},
+		{value: "1e3", code: "PLN", err: ErrInvalidAmount},
+		{value: ".50", code: "PLN", err: ErrInvalidAmount},
+		{value: "", code: "PLN", err: ErrInvalidAmount},
+		{value: "99999999999999999999", code: "PLN", err: ErrInvalidAmount},
+		{value: "10", code: "XYZ", err: ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value, tt.code)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q, %s) error = %v, want %v", tt.value, tt.code, err, tt.err)
+			continue
+		}
+		if err == nil && got.Amount != tt.want {
+			t.Errorf("Parse(%q, %s) = %d, want %d", tt.value, tt.code, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount int64
+		code   string
+		lang   string
+		want   string
+	}{
+		{amount: 15000, code: "PLN", lang: "pl", want: "150,00 zł"},
+		{amount: 150000050, code: "PLN", lang: "pl-PL", want: "1 500 000,50 zł"},
+		{amount: 1250, code: "EUR", lang: "en", want: "€12.50"},
+		{amount: 1250, code: "EUR", lang: "de", want: "12,50 €"},
+		{amount: 123456, code: "USD", lang: "en_US", want: "$1,234.56"},
+		{amount: 15000, code: "PLN", lang: "en", want: "PLN 150.00"},
+		{amount: 99900, code: "CZK", lang: "cs", want: "999,00 Kč"},
+		{amount: 99900, code: "CZK", lang: "pl", want: "999,00 CZK"},
+		{amount: 5, code: "PLN", lang: "", want: "0,05 zł"},
+		{amount: 1500, code: "JPY", lang: "en", want: "¥1,500"},
+		{amount: 1234, code: "KWD", lang: "en", want: "KWD 1.234"},
+		{amount: -310, code: "GBP", lang: "en", want: "-£3.10"},
+		{amount: 15000, code: "PLN", lang: "klingon", want: "150,00 zł"},
+	}
+
+	for _, tt := range tests {
+		m, err := New(tt.amount, tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Format(tt.lang); got != tt.want {
+			t.Errorf("New(%d, %s).Format(%q) = %q, want %q", tt.amount, tt.code, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	m, _ := New(10001, "PLN")
+	parts := m.Split(3)
+
+	want := []int64{3334, 3334, 3333}
+	var sum int64
+	for i, part := range parts {
+		if part.Amount != want[i] || part.Currency.Code != "PLN" {
+			t.Errorf("part %d = %+v, want %d PLN", i, part, want[i])
+		}
+		sum += part.Amount
+	}
+	if sum != m.Amount {
+		t.Errorf("parts sum to %d, want %d", sum, m.Amount)
+	}
+}
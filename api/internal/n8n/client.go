@@ -0,0 +1,286 @@
+package n8n
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Headers sent with every webhook. The signature is "sha256=" followed by the
+// hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the shared secret, so
+// n8n can reject forged and replayed events. The event id stays the same across
+// redeliveries.
+const (
+	HeaderEventID   = "X-Claimsio-Event-Id"
+	HeaderTimestamp = "X-Claimsio-Timestamp"
+	HeaderSignature = "X-Claimsio-Signature"
+)
+
+// Client posts events to n8n webhooks and looks up debtors.
+type Client struct {
+	BaseURL    string
+	AuthToken  string
+	Secret     string
+	HTTPClient *http.Client
+
+	// attempts per delivery and the delay before the first retry, doubled
+	// after every failure
+	MaxAttempts int
+	Backoff     time.Duration
+
+	// failed events are parked here for redelivery, may be nil
+	Outbox Outbox
+}
+
+func New(baseURL, authToken string) *Client {
+	return &Client{
+		BaseURL:     strings.TrimSuffix(baseURL, "/"),
+		AuthToken:   authToken,
+		HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 4,
+		Backoff:     500 * time.Millisecond,
+	}
+}
+
+// Event is a webhook delivery to a single n8n endpoint.
+type Event struct {
+	ID        string          `json:"id"`
+	Endpoint  string          `json:"endpoint"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+}
+
+func NewEvent(endpoint string, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("error marshaling webhook payload: %v", err)
+	}
+	return Event{
+		ID:        newEventID(),
+		Endpoint:  endpoint,
+		Payload:   data,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Send delivers payload to the endpoint webhook, retrying transient failures
+// with exponential backoff. When every attempt fails the event is handed to
+// the outbox and the delivery error is returned.
+func (c *Client) Send(ctx context.Context, endpoint string, payload interface{}) error {
+	event, err := NewEvent(endpoint, payload)
+	if err != nil {
+		return err
+	}
+	return c.SendEvent(ctx, event)
+}
+
+// SendEvent is Send for an event built by the caller, e.g. with an id derived
+// from the business object so n8n can deduplicate it.
+func (c *Client) SendEvent(ctx context.Context, event Event) error {
+	err := c.deliverWithRetry(ctx, event)
+	if err == nil {
+		return nil
+	}
+	return c.park(event, c.maxAttempts(), err)
+}
+
+// Notify is Send for request handlers that cannot wait for retries: it makes
+// a single delivery attempt and leaves a failed event to the outbox.
+// Without an outbox it is Send.
+func (c *Client) Notify(ctx context.Context, endpoint string, payload interface{}) error {
+	event, err := NewEvent(endpoint, payload)
+	if err != nil {
+		return err
+	}
+	return c.NotifyEvent(ctx, event)
+}
+
+// NotifyEvent is Notify for an event built by the caller.
+func (c *Client) NotifyEvent(ctx context.Context, event Event) error {
+	if c.Outbox == nil {
+		return c.SendEvent(ctx, event)
+	}
+
+	err := c.deliver(ctx, event)
+	if err == nil {
+		return nil
+	}
+	return c.park(event, 1, err)
+}
+
+// park hands an event that failed after attempts deliveries to the outbox,
+// or to the dead letters when retrying cannot help.
+func (c *Client) park(event Event, attempts int, err error) error {
+	if c.Outbox != nil {
+		event.Attempts = attempts
+		event.LastError = err.Error()
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			err = errors.Join(err, c.Outbox.DeadLetter(context.Background(), event))
+		} else {
+			err = errors.Join(err, c.Outbox.Add(context.Background(), event))
+		}
+	}
+
+	return fmt.Errorf("webhook %s failed: %w", event.Endpoint, err)
+}
+
+func (c *Client) deliverWithRetry(ctx context.Context, event Event) error {
+	delay := c.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = c.deliver(ctx, event)
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= c.maxAttempts() {
+			return err
+		}
+
+		zap.L().Warn("n8n webhook failed, retrying",
+			zap.String("endpoint", event.Endpoint),
+			zap.Int("attempt", attempt),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// deliver makes a single delivery attempt.
+func (c *Client) deliver(ctx context.Context, event Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(event.Endpoint), bytes.NewReader(event.Payload))
+	if err != nil {
+		return &permanentError{fmt.Errorf("error creating webhook request: %v", err)}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, event.ID)
+	c.sign(req, event.Payload)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("webhook failed with status %d: %s", resp.StatusCode, string(body))
+
+	// client errors will not go away by retrying
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// ErrUnknownDebtor is returned by CheckUser when no debtor has the number.
+var ErrUnknownDebtor = errors.New("n8n: unknown debtor")
+
+// CheckUser looks up the debtor registered for phone.
+func (c *Client) CheckUser(ctx context.Context, phone string) (map[string]interface{}, error) {
+	jsonData, err := json.Marshal(map[string]string{"phone": phone})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("check-user"), bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.sign(req, jsonData)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrUnknownDebtor
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user check failed with status: %d", resp.StatusCode)
+	}
+
+	var userData map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&userData); err != nil {
+		return nil, err
+	}
+
+	return userData, nil
+}
+
+func (c *Client) url(endpoint string) string {
+	return fmt.Sprintf("%s/%s", c.BaseURL, endpoint)
+}
+
+func (c *Client) sign(req *http.Request, body []byte) {
+	if c.AuthToken != "" {
+		req.Header.Set("Authorization", c.AuthToken)
+	}
+	if c.Secret == "" {
+		return
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(c.Secret, timestamp, body))
+}
+
+func (c *Client) maxAttempts() int {
+	if c.MaxAttempts < 1 {
+		return 1
+	}
+	return c.MaxAttempts
+}
+
+// Sign computes the HeaderSignature value for a request body, in the form
+// "sha256=<hex>".
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "evt_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,207 @@
+package n8n
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer answers with the queued status codes, then 200.
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(body))
+
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func newTestClient(t *testing.T, url string) (*Client, *FileOutbox) {
+	outbox, err := NewFileOutbox(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(url+"/webhook/", "token")
+	c.Secret = "secret"
+	c.Backoff = time.Millisecond
+	c.MaxAttempts = 3
+	c.Outbox = outbox
+	return c, outbox
+}
+
+func TestSendRetriesAndSigns(t *testing.T) {
+	srv := newWebhookServer(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+	c, outbox := newTestClient(t, srv.URL)
+
+	if err := c.Send(context.Background(), "inbound-calls", map[string]string{"call_sid": "CA1"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if srv.count() != 3 {
+		t.Fatalf("got %d attempts want 3", srv.count())
+	}
+
+	req, body := srv.requests[2], srv.bodies[2]
+	if req.URL.Path != "/webhook/inbound-calls" {
+		t.Errorf("path: got %q", req.URL.Path)
+	}
+	if req.Header.Get("Authorization") != "token" {
+		t.Errorf("authorization: got %q", req.Header.Get("Authorization"))
+	}
+	want := Sign("secret", req.Header.Get(HeaderTimestamp), []byte(body))
+	if got := req.Header.Get(HeaderSignature); got != want {
+		t.Errorf("signature: got %q want %q", got, want)
+	}
+	if srv.requests[0].Header.Get(HeaderEventID) != req.Header.Get(HeaderEventID) {
+		t.Error("event id changed between attempts")
+	}
+
+	if pending, _ := outbox.Pending(context.Background()); len(pending) != 0 {
+		t.Errorf("got %d pending events want 0", len(pending))
+	}
+}
+
+func TestSendParksFailedEventsForRedelivery(t *testing.T) {
+	srv := newWebhookServer(t, 500, 500, 500)
+	c, outbox := newTestClient(t, srv.URL)
+
+	if err := c.Send(context.Background(), "outbound-calls", map[string]string{"call_sid": "CA2"}); err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	pending, err := outbox.Pending(context.Background())
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("got %d pending events (%v) want 1", len(pending), err)
+	}
+	if pending[0].Endpoint != "outbound-calls" || pending[0].Attempts != 3 {
+		t.Errorf("unexpected pending event: %+v", pending[0])
+	}
+
+	// n8n is back
+	c.Redeliver(context.Background())
+
+	if srv.count() != 4 {
+		t.Errorf("got %d requests want 4", srv.count())
+	}
+	if srv.bodies[3] != `{"call_sid":"CA2"}` {
+		t.Errorf("redelivered body: got %s", srv.bodies[3])
+	}
+	if pending, _ := outbox.Pending(context.Background()); len(pending) != 0 {
+		t.Errorf("got %d pending events after redelivery want 0", len(pending))
+	}
+}
+
+func TestSendDeadLettersClientErrors(t *testing.T) {
+	srv := newWebhookServer(t, http.StatusBadRequest)
+	c, outbox := newTestClient(t, srv.URL)
+
+	if err := c.Send(context.Background(), "inbound-calls", map[string]string{}); err == nil {
+		t.Fatal("expected delivery error")
+	}
+	if srv.count() != 1 {
+		t.Errorf("client errors must not be retried, got %d attempts", srv.count())
+	}
+	if pending, _ := outbox.Pending(context.Background()); len(pending) != 0 {
+		t.Errorf("got %d pending events want 0", len(pending))
+	}
+
+	dead, _ := filepath.Glob(filepath.Join(outbox.dir, "dead", "*.json"))
+	if len(dead) != 1 {
+		t.Fatalf("got %d dead letters want 1", len(dead))
+	}
+	if _, err := os.Stat(dead[0]); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNotifyMakesOneAttempt(t *testing.T) {
+	srv := newWebhookServer(t, http.StatusBadGateway)
+	c, outbox := newTestClient(t, srv.URL)
+
+	if err := c.Notify(context.Background(), "payments", map[string]string{"id": "evt_1"}); err == nil {
+		t.Fatal("expected delivery error")
+	}
+	if srv.count() != 1 {
+		t.Errorf("got %d attempts want 1", srv.count())
+	}
+
+	pending, err := outbox.Pending(context.Background())
+	if err != nil || len(pending) != 1 || pending[0].Attempts != 1 {
+		t.Fatalf("got pending events %+v (%v) want one after 1 attempt", pending, err)
+	}
+
+	c.Redeliver(context.Background())
+	if pending, _ := outbox.Pending(context.Background()); len(pending) != 0 {
+		t.Errorf("got %d pending events after redelivery want 0", len(pending))
+	}
+}
+
+func TestPendingSkipsCorruptEntries(t *testing.T) {
+	outbox, err := NewFileOutbox(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event, _ := NewEvent("inbound-calls", map[string]string{"call_sid": "CA3"})
+	if err := outbox.Add(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outbox.dir, "broken.json"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := outbox.Pending(context.Background())
+	if err != nil || len(pending) != 1 || pending[0].ID != event.ID {
+		t.Fatalf("got pending events %+v (%v) want %s", pending, err, event.ID)
+	}
+	if _, err := os.Stat(filepath.Join(outbox.dir, "dead", "broken.json")); err != nil {
+		t.Errorf("corrupt entry not moved to dead letters: %v", err)
+	}
+}
+
+func TestCheckUser(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/webhook/check-user" {
+			t.Errorf("path: got %q", r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL+"/webhook", "")
+	if _, err := c.CheckUser(context.Background(), "+48500100200"); err != ErrUnknownDebtor {
+		t.Errorf("got %v want ErrUnknownDebtor", err)
+	}
+}
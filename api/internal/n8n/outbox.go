@@ -0,0 +1,185 @@
+package n8n
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Outbox keeps events that could not be delivered. Pending events are
+// redelivered by Client.RunOutbox, dead letters wait for an operator.
+type Outbox interface {
+	Add(ctx context.Context, event Event) error
+	Pending(ctx context.Context) ([]Event, error)
+	Remove(ctx context.Context, id string) error
+	DeadLetter(ctx context.Context, event Event) error
+}
+
+// FileOutbox stores one JSON file per event, pending events in dir and dead
+// letters in dir/dead.
+type FileOutbox struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileOutbox(dir string) (*FileOutbox, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "dead"), 0o755); err != nil {
+		return nil, err
+	}
+	return &FileOutbox{dir: dir}, nil
+}
+
+func (o *FileOutbox) Add(ctx context.Context, event Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return writeEvent(o.path(event.ID), event)
+}
+
+func (o *FileOutbox) Pending(ctx context.Context) ([]Event, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(o.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		var event Event
+		if err == nil {
+			err = json.Unmarshal(data, &event)
+		}
+		if err != nil {
+			// one bad entry must not hold up the rest of the queue
+			zap.L().Error("Moving unreadable n8n outbox entry to dead letters",
+				zap.String("path", path), zap.Error(err))
+			if err := os.Rename(path, filepath.Join(o.dir, "dead", filepath.Base(path))); err != nil {
+				zap.L().Error("Failed to move n8n outbox entry", zap.String("path", path), zap.Error(err))
+			}
+			continue
+		}
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+	return events, nil
+}
+
+func (o *FileOutbox) Remove(ctx context.Context, id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	err := os.Remove(o.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (o *FileOutbox) DeadLetter(ctx context.Context, event Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err := writeEvent(filepath.Join(o.dir, "dead", event.ID+".json"), event); err != nil {
+		return err
+	}
+	err := os.Remove(o.path(event.ID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (o *FileOutbox) path(id string) string {
+	return filepath.Join(o.dir, filepath.Base(id)+".json")
+}
+
+// writeEvent replaces path atomically so a crash never leaves half an event.
+func writeEvent(path string, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// MaxRedeliveries is how many outbox rounds an event gets before it is moved
+// to the dead letters.
+const MaxRedeliveries = 20
+
+// RunOutbox redelivers pending outbox events every interval until ctx is
+// cancelled.
+func (c *Client) RunOutbox(ctx context.Context, interval time.Duration) {
+	if c.Outbox == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Redeliver(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Redeliver makes one delivery attempt for every pending outbox event.
+func (c *Client) Redeliver(ctx context.Context) {
+	events, err := c.Outbox.Pending(ctx)
+	if err != nil {
+		zap.L().Error("Failed to read n8n outbox", zap.Error(err))
+		return
+	}
+
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return
+		}
+
+		err := c.deliver(ctx, event)
+		if err == nil {
+			if err := c.Outbox.Remove(ctx, event.ID); err != nil {
+				zap.L().Error("Failed to remove delivered n8n event", zap.String("event_id", event.ID), zap.Error(err))
+			}
+			continue
+		}
+
+		event.Attempts++
+		event.LastError = err.Error()
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || event.Attempts >= c.maxAttempts()+MaxRedeliveries {
+			zap.L().Error("Giving up on n8n event",
+				zap.String("event_id", event.ID),
+				zap.String("endpoint", event.Endpoint),
+				zap.Error(err))
+			err = c.Outbox.DeadLetter(ctx, event)
+		} else {
+			err = c.Outbox.Add(ctx, event)
+		}
+		if err != nil {
+			zap.L().Error("Failed to update n8n outbox", zap.String("event_id", event.ID), zap.Error(err))
+		}
+	}
+}
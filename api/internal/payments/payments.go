@@ -0,0 +1,83 @@
+// Package payments holds the Stripe clients used to take debt payments. Each
+// environment gets its own client.API, so test and live requests never share
+// the package-global stripe.Key.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"claimsio/internal/config"
+	"claimsio/internal/middleware"
+
+	"github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/client"
+)
+
+// Environment is a Stripe mode. The values match the environment column of
+// stored payment links.
+type Environment string
+
+const (
+	Test Environment = "test"
+	Live Environment = "production"
+)
+
+// ErrNotConfigured is returned for an environment without a Stripe key.
+var ErrNotConfigured = errors.New("payments: stripe environment not configured")
+
+// Service hands out the Stripe client of an environment and the payment
+// profiles of creditors.
+type Service struct {
+	// creditor profiles, DefaultProfiles unless replaced
+	Profiles map[string]Profile
+
+	clients map[Environment]*client.API
+}
+
+// NewService creates a client per configured key. backends may be nil to use
+// the default Stripe backends; tests pass fakes.
+func NewService(testKey, liveKey string, backends *stripe.Backends) *Service {
+	s := &Service{
+		Profiles: DefaultProfiles,
+		clients:  make(map[Environment]*client.API),
+	}
+	if testKey != "" {
+		s.clients[Test] = client.New(testKey, backends)
+	}
+	if liveKey != "" {
+		s.clients[Live] = client.New(liveKey, backends)
+	}
+	return s
+}
+
+// Client returns the Stripe client of env.
+func (s *Service) Client(env Environment) (*client.API, error) {
+	sc, ok := s.clients[env]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotConfigured, env)
+	}
+	return sc, nil
+}
+
+// Profile returns the profile of creditor. An empty creditor gets the
+// DefaultCreditor profile.
+func (s *Service) Profile(creditor string) (Profile, bool) {
+	if creditor == "" {
+		creditor = DefaultCreditor
+	}
+	p, ok := s.Profiles[creditor]
+	return p, ok
+}
+
+// EnvironmentFor returns the environment a request may use. Only API keys
+// granted config.ScopePaymentsLive by name reach the live account, "*" is not
+// enough. Unauthenticated requests always get test mode.
+func EnvironmentFor(ctx context.Context) Environment {
+	key, ok := middleware.APIKeyFromContext(ctx)
+	if ok && key.HasScope(config.ScopePaymentsLive) {
+		return Live
+	}
+	return Test
+}
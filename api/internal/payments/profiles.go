@@ -0,0 +1,179 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"claimsio/internal/money"
+)
+
+// DefaultCreditor is the profile used for cases without a creditor of their
+// own.
+const DefaultCreditor = "default"
+
+// ErrCurrencyNotAccepted is returned when a creditor takes no payments in a
+// currency.
+var ErrCurrencyNotAccepted = errors.New("payments: currency not accepted")
+
+// Profile is how a creditor takes payments: which payment methods are
+// offered, where the debtor lands afterwards and how the charge is labelled.
+type Profile struct {
+	// Stripe payment method types keyed by currency code, "*" for any other
+	// currency
+	PaymentMethods map[string][]string `json:"payment_methods"`
+	SuccessURL     string              `json:"success_url"`
+	// shown on card statements after the account's own descriptor
+	StatementDescriptor string `json:"statement_descriptor,omitempty"`
+	// Stripe product name, {creditor} and {case_id} are replaced
+	ProductName string `json:"product_name"`
+}
+
+// DefaultProfiles apply when no profiles file is configured, keyed by
+// creditor id.
+var DefaultProfiles = map[string]Profile{
+	DefaultCreditor: {
+		PaymentMethods: map[string][]string{
+			"PLN": {"blik", "p24", "card"},
+			"*":   {"card"},
+		},
+		SuccessURL:  "https://pay.claimsio.com/dashboard",
+		ProductName: "Debt payment",
+	},
+}
+
+// paymentMethodCurrencies lists the currencies Stripe supports for each
+// payment method. Methods in neither this table nor anyCurrencyMethods are
+// rejected.
+var paymentMethodCurrencies = map[string][]string{
+	"blik":            {"PLN"},
+	"p24":             {"PLN", "EUR"},
+	"bancontact":      {"EUR"},
+	"eps":             {"EUR"},
+	"giropay":         {"EUR"},
+	"ideal":           {"EUR"},
+	"sofort":          {"EUR"},
+	"sepa_debit":      {"EUR"},
+	"bacs_debit":      {"GBP"},
+	"us_bank_account": {"USD"},
+	"klarna":          {"EUR", "USD", "GBP", "DKK", "NOK", "SEK", "CZK", "PLN", "CHF"},
+}
+
+// anyCurrencyMethods may be listed under "*".
+var anyCurrencyMethods = map[string]bool{
+	"card": true,
+	"link": true,
+}
+
+// LoadProfiles reads creditor profiles from a JSON file shaped like
+// DefaultProfiles. Creditors in the file replace the defaults, the rest are
+// kept. An empty path returns the defaults.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile, len(DefaultProfiles))
+	for creditor, p := range DefaultProfiles {
+		profiles[creditor] = p
+	}
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read creditor profiles: %w", err)
+	}
+	var overrides map[string]Profile
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse creditor profiles: %w", err)
+	}
+
+	for creditor, p := range overrides {
+		methods := make(map[string][]string, len(p.PaymentMethods))
+		for code, m := range p.PaymentMethods {
+			methods[strings.ToUpper(code)] = m
+		}
+		p.PaymentMethods = methods
+
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("invalid profile for creditor %s: %w", creditor, err)
+		}
+		profiles[creditor] = p
+	}
+
+	return profiles, nil
+}
+
+func (p Profile) validate() error {
+	if len(p.PaymentMethods) == 0 {
+		return errors.New("no payment methods")
+	}
+	for code, methods := range p.PaymentMethods {
+		if len(methods) == 0 {
+			return fmt.Errorf("no payment methods for %s", code)
+		}
+		if code == "*" {
+			for _, method := range methods {
+				if !anyCurrencyMethods[method] {
+					return fmt.Errorf("payment method %s cannot be offered for every currency", method)
+				}
+			}
+			continue
+		}
+
+		currency, err := money.LookupCurrency(code)
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			if !methodAccepts(method, currency) {
+				return fmt.Errorf("payment method %s does not support %s", method, currency.Code)
+			}
+		}
+	}
+
+	if !strings.HasPrefix(p.SuccessURL, "https://") {
+		return fmt.Errorf("success_url %q must be an https url", p.SuccessURL)
+	}
+	if p.ProductName == "" {
+		return errors.New("missing product_name")
+	}
+	if d := p.StatementDescriptor; d != "" {
+		if len(d) > 22 || strings.ContainsAny(d, `<>\'"*`) || strings.IndexFunc(d, unicode.IsLetter) < 0 {
+			return fmt.Errorf("statement_descriptor %q must be up to 22 characters with a letter and no <>\\'\"*", d)
+		}
+	}
+
+	return nil
+}
+
+func methodAccepts(method string, currency money.Currency) bool {
+	if anyCurrencyMethods[method] {
+		return true
+	}
+	for _, code := range paymentMethodCurrencies[method] {
+		if code == currency.Code {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentMethodsFor returns the payment methods offered for currency, or
+// ErrCurrencyNotAccepted.
+func (p Profile) PaymentMethodsFor(currency money.Currency) ([]string, error) {
+	methods, ok := p.PaymentMethods[currency.Code]
+	if !ok {
+		methods, ok = p.PaymentMethods["*"]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCurrencyNotAccepted, currency.Code)
+	}
+	return methods, nil
+}
+
+// ProductNameFor fills in the product name template.
+func (p Profile) ProductNameFor(creditor, caseID string) string {
+	return strings.NewReplacer("{creditor}", creditor, "{case_id}", caseID).Replace(p.ProductName)
+}
@@ -0,0 +1,80 @@
+package payments
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"claimsio/internal/money"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	os.WriteFile(path, []byte(`{
+		"acme": {
+			"payment_methods": {"eur": ["card", "ideal", "sepa_debit"]},
+			"success_url": "https://pay.acme.example/thanks",
+			"statement_descriptor": "ACME DEBT",
+			"product_name": "{creditor} case {case_id}"
+		}
+	}`), 0o600)
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := profiles[DefaultCreditor]; !ok {
+		t.Error("default profile dropped")
+	}
+
+	acme := profiles["acme"]
+	eur, _ := money.LookupCurrency("EUR")
+	if methods, err := acme.PaymentMethodsFor(eur); err != nil || len(methods) != 3 {
+		t.Errorf("EUR methods = %v, %v", methods, err)
+	}
+	pln, _ := money.LookupCurrency("PLN")
+	if _, err := acme.PaymentMethodsFor(pln); !errors.Is(err, ErrCurrencyNotAccepted) {
+		t.Errorf("PLN error = %v, want ErrCurrencyNotAccepted", err)
+	}
+	if got := acme.ProductNameFor("acme", "case9"); got != "acme case case9" {
+		t.Errorf("product name = %q", got)
+	}
+
+	// the default profile only offers BLIK and Przelewy24 for złoty
+	if methods, _ := DefaultProfiles[DefaultCreditor].PaymentMethodsFor(eur); len(methods) != 1 || methods[0] != "card" {
+		t.Errorf("default EUR methods = %v, want [card]", methods)
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	valid := Profile{
+		PaymentMethods: map[string][]string{"PLN": {"blik", "card"}, "*": {"card"}},
+		SuccessURL:     "https://pay.example/done",
+		ProductName:    "Debt payment",
+	}
+	if err := valid.validate(); err != nil {
+		t.Fatalf("valid profile rejected: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(p *Profile)
+	}{
+		{"blik for euro", func(p *Profile) { p.PaymentMethods = map[string][]string{"EUR": {"blik"}} }},
+		{"blik for any currency", func(p *Profile) { p.PaymentMethods = map[string][]string{"*": {"card", "blik"}} }},
+		{"unknown method", func(p *Profile) { p.PaymentMethods = map[string][]string{"PLN": {"cash"}} }},
+		{"unknown currency", func(p *Profile) { p.PaymentMethods = map[string][]string{"XYZ": {"card"}} }},
+		{"plain http redirect", func(p *Profile) { p.SuccessURL = "http://pay.example/done" }},
+		{"missing product name", func(p *Profile) { p.ProductName = "" }},
+		{"long descriptor", func(p *Profile) { p.StatementDescriptor = "A VERY LONG STATEMENT DESCRIPTOR" }},
+		{"descriptor without letters", func(p *Profile) { p.StatementDescriptor = "12345" }},
+	}
+	for _, tt := range tests {
+		p := valid
+		tt.modify(&p)
+		if err := p.validate(); err == nil {
+			t.Errorf("%s: profile accepted", tt.name)
+		}
+	}
+}
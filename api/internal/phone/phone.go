@@ -0,0 +1,155 @@
+// Package phone normalizes phone numbers to E.164 so the same debtor is
+// recognised however their number was typed.
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultRegion is assumed for numbers written without a country code.
+const DefaultRegion = "PL"
+
+var (
+	ErrInvalid = errors.New("phone: invalid number")
+	ErrPremium = errors.New("phone: premium rate number")
+)
+
+// region describes the national numbering plan of a country we call.
+type region struct {
+	code string
+	// national number length without the trunk prefix
+	minLen, maxLen int
+	trunk          string
+	// national prefixes of premium rate services we never call or text
+	premium []string
+}
+
+var regions = map[string]region{
+	"PL": {code: "48", minLen: 9, maxLen: 9, premium: []string{"70"}},
+	"CZ": {code: "420", minLen: 9, maxLen: 9, premium: []string{"90"}},
+	"SK": {code: "421", minLen: 9, maxLen: 9, trunk: "0", premium: []string{"900", "976", "977"}},
+	"DE": {code: "49", minLen: 6, maxLen: 13, trunk: "0", premium: []string{"900", "137"}},
+	"LT": {code: "370", minLen: 8, maxLen: 8, trunk: "8", premium: []string{"90"}},
+	"UA": {code: "380", minLen: 9, maxLen: 9, trunk: "0", premium: []string{"900"}},
+	"GB": {code: "44", minLen: 9, maxLen: 10, trunk: "0", premium: []string{"9"}},
+	"US": {code: "1", minLen: 10, maxLen: 10, trunk: "1", premium: []string{"900", "976"}},
+}
+
+// Normalize parses raw in the default region, see Parse.
+func Normalize(raw string) (string, error) {
+	return Parse(raw, DefaultRegion)
+}
+
+// Parse returns raw in E.164 form, e.g. "+48732145999". Numbers without a
+// "+" or "00" prefix are read as national numbers of regionCode. Spaces,
+// dashes, dots, slashes and parentheses are ignored, as is a "(0)" trunk
+// marker after the country code.
+func Parse(raw, regionCode string) (string, error) {
+	home, ok := regions[regionCode]
+	if !ok {
+		return "", fmt.Errorf("phone: unknown region %q", regionCode)
+	}
+
+	digits, international, err := clean(raw)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case international:
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case len(digits) > home.maxLen && strings.HasPrefix(digits, home.code):
+		// country code typed without the "+"
+	default:
+		national := digits
+		if home.trunk != "" {
+			national = strings.TrimPrefix(national, home.trunk)
+		}
+		digits = home.code + national
+	}
+
+	if err := validate(digits); err != nil {
+		return "", fmt.Errorf("%w: %q", err, raw)
+	}
+
+	return "+" + digits, nil
+}
+
+// Valid reports whether raw is a callable number in the default region.
+func Valid(raw string) bool {
+	_, err := Normalize(raw)
+	return err == nil
+}
+
+func clean(raw string) (digits string, international bool, err error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "+") {
+		international = true
+		raw = raw[1:]
+	}
+	// "+44 (0)20 ..." shows the trunk prefix that is dropped when dialling
+	// from abroad
+	if international || strings.HasPrefix(raw, "00") {
+		raw = strings.Replace(raw, "(0)", "", 1)
+	}
+
+	var b strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '/' || r == '(' || r == ')':
+		default:
+			return "", false, fmt.Errorf("%w: %q", ErrInvalid, raw)
+		}
+	}
+
+	return b.String(), international, nil
+}
+
+// validate checks the country code and national number of digits, an E.164
+// number without the "+".
+func validate(digits string) error {
+	// E.164 allows at most 15 digits, the shortest real numbers have 8
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return ErrInvalid
+	}
+
+	_, r, ok := lookup(digits)
+	if !ok {
+		return nil
+	}
+
+	national := digits[len(r.code):]
+	if len(national) < r.minLen || len(national) > r.maxLen || national[0] == '0' {
+		return ErrInvalid
+	}
+	for _, prefix := range r.premium {
+		if strings.HasPrefix(national, prefix) {
+			return ErrPremium
+		}
+	}
+
+	return nil
+}
+
+// Region returns the ISO country code, e.g. "PL", of an E.164 number. It
+// reports false for countries outside the numbering plans we know.
+func Region(e164 string) (string, bool) {
+	name, _, ok := lookup(strings.TrimPrefix(e164, "+"))
+	return name, ok
+}
+
+func lookup(digits string) (string, region, bool) {
+	for n := 3; n >= 1; n-- {
+		for name, r := range regions {
+			if len(r.code) == n && strings.HasPrefix(digits, r.code) {
+				return name, r, true
+			}
+		}
+	}
+	return "", region{}, false
+}
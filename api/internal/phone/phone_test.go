@@ -0,0 +1,72 @@
+package phone
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		err  error
+	}{
+		{raw: "+48732145999", want: "+48732145999"},
+		{raw: "+48 732 145 999", want: "+48732145999"},
+		{raw: "0048732145999", want: "+48732145999"},
+		{raw: "732145999", want: "+48732145999"},
+		{raw: "732-145-999", want: "+48732145999"},
+		{raw: "48732145999", want: "+48732145999"},
+		{raw: " +44 (0)20 7946 0018", want: "+442079460018"},
+		{raw: "0044 (0)20 7946 0018", want: "+442079460018"},
+		{raw: "+44 20 7946 0018", want: "+442079460018"},
+		{raw: "+1 (415) 555-0100", want: "+14155550100"},
+		{raw: "+48 701 234 567", err: ErrPremium},
+		{raw: "+1 900 555 0100", err: ErrPremium},
+		{raw: "+421 905 123 456", want: "+421905123456"},
+		{raw: "+421 900 123 456", err: ErrPremium},
+		{raw: "12345", err: ErrInvalid},
+		{raw: "+48 32 145 999", err: ErrInvalid},
+		{raw: "+48 1234567890", err: ErrInvalid},
+		{raw: "anonymous", err: ErrInvalid},
+		{raw: "", err: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := Normalize(tt.raw)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Normalize(%q) error = %v, want %v", tt.raw, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	got, err := Parse("030 12345678", "DE")
+	if err != nil || got != "+493012345678" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if _, err := Parse("732145999", "XX"); err == nil {
+		t.Error("expected unknown region error")
+	}
+}
+
+func TestRegion(t *testing.T) {
+	for number, want := range map[string]string{
+		"+48732145999":  "PL",
+		"+420601123456": "CZ",
+		"+14155550100":  "US",
+	} {
+		if got, ok := Region(number); !ok || got != want {
+			t.Errorf("Region(%q) = %q, %v, want %q", number, got, ok, want)
+		}
+	}
+	if _, ok := Region("+61412345678"); ok {
+		t.Error("expected unknown region for +61")
+	}
+}
@@ -0,0 +1,154 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ElevenLabs ConvAI websocket event types
+// https://elevenlabs.io/docs/conversational-ai/api-reference/conversational-ai/websocket
+const (
+	ElevenLabsConversationInitiationMetadata = "conversation_initiation_metadata"
+	ElevenLabsAudio                          = "audio"
+	ElevenLabsInterruption                   = "interruption"
+	ElevenLabsPing                           = "ping"
+	ElevenLabsAgentResponse                  = "agent_response"
+	ElevenLabsUserTranscript                 = "user_transcript"
+	ElevenLabsClientToolCall                 = "client_tool_call"
+
+	ElevenLabsConversationInitiationClientData = "conversation_initiation_client_data"
+	ElevenLabsPong                             = "pong"
+	ElevenLabsClientToolResult                 = "client_tool_result"
+	ElevenLabsEndConversation                  = "end_conversation"
+)
+
+// ElevenLabsMessage is a single event received from the ConvAI websocket.
+// Only the field matching Type is populated.
+type ElevenLabsMessage struct {
+	Type string `json:"type"`
+
+	ConversationInitiationMetadata *ConversationInitiationMetadata `json:"conversation_initiation_metadata_event,omitempty"`
+	Audio                          *AudioEvent                     `json:"audio_event,omitempty"`
+	Interruption                   *InterruptionEvent              `json:"interruption_event,omitempty"`
+	Ping                           *PingEvent                      `json:"ping_event,omitempty"`
+	AgentResponse                  *AgentResponseEvent             `json:"agent_response_event,omitempty"`
+	UserTranscript                 *UserTranscriptEvent            `json:"user_transcription_event,omitempty"`
+	ClientToolCall                 *ClientToolCall                 `json:"client_tool_call,omitempty"`
+}
+
+type ConversationInitiationMetadata struct {
+	ConversationID         string `json:"conversation_id"`
+	AgentOutputAudioFormat string `json:"agent_output_audio_format"`
+	UserInputAudioFormat   string `json:"user_input_audio_format"`
+}
+
+type AudioEvent struct {
+	AudioBase64 string `json:"audio_base_64"`
+	EventID     int64  `json:"event_id"`
+}
+
+type InterruptionEvent struct {
+	EventID int64 `json:"event_id"`
+}
+
+type PingEvent struct {
+	EventID int64 `json:"event_id"`
+	PingMs  int64 `json:"ping_ms,omitempty"`
+}
+
+type AgentResponseEvent struct {
+	AgentResponse string `json:"agent_response"`
+}
+
+type UserTranscriptEvent struct {
+	UserTranscript string `json:"user_transcript"`
+}
+
+type ClientToolCall struct {
+	ToolName   string                 `json:"tool_name"`
+	ToolCallID string                 `json:"tool_call_id"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// DecodeElevenLabs parses a ConvAI event and checks that the payload
+// required by its type is present. Unknown types decode without error so
+// callers can ignore them.
+func DecodeElevenLabs(data []byte) (*ElevenLabsMessage, error) {
+	var msg ElevenLabsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("invalid elevenlabs message: %w", err)
+	}
+
+	var missing bool
+	switch msg.Type {
+	case "":
+		return nil, fmt.Errorf("invalid elevenlabs message: missing type")
+	case ElevenLabsConversationInitiationMetadata:
+		missing = msg.ConversationInitiationMetadata == nil
+	case ElevenLabsAudio:
+		missing = msg.Audio == nil
+	case ElevenLabsPing:
+		missing = msg.Ping == nil
+	case ElevenLabsAgentResponse:
+		missing = msg.AgentResponse == nil
+	case ElevenLabsUserTranscript:
+		missing = msg.UserTranscript == nil
+	case ElevenLabsClientToolCall:
+		missing = msg.ClientToolCall == nil
+	}
+	if missing {
+		return nil, fmt.Errorf("invalid elevenlabs %s message: missing event payload", msg.Type)
+	}
+
+	return &msg, nil
+}
+
+// ConversationInitiationClientData is the first message sent after
+// connecting; it overrides the agent prompt for this conversation.
+type ConversationInitiationClientData struct {
+	Type                       string `json:"type"`
+	ConversationConfigOverride struct {
+		Agent struct {
+			Prompt struct {
+				Prompt string `json:"prompt"`
+			} `json:"prompt"`
+			FirstMessage string `json:"first_message"`
+		} `json:"agent"`
+	} `json:"conversation_config_override"`
+	ClientData struct {
+		DynamicVariables map[string]string `json:"dynamic_variables,omitempty"`
+	} `json:"client_data,omitempty"`
+}
+
+type UserAudioChunk struct {
+	UserAudioChunk string `json:"user_audio_chunk"`
+}
+
+type Pong struct {
+	Type    string `json:"type"`
+	EventID int64  `json:"event_id"`
+}
+
+type ClientToolResult struct {
+	Type       string `json:"type"`
+	ToolCallID string `json:"tool_call_id"`
+	Result     string `json:"result"`
+	IsError    bool   `json:"is_error"`
+}
+
+type EndConversation struct {
+	Type string `json:"type"`
+}
+
+func NewPong(eventID int64) Pong {
+	return Pong{Type: ElevenLabsPong, EventID: eventID}
+}
+
+func NewClientToolResult(toolCallID, result string, isError bool) ClientToolResult {
+	return ClientToolResult{
+		Type:       ElevenLabsClientToolResult,
+		ToolCallID: toolCallID,
+		Result:     result,
+		IsError:    isError,
+	}
+}
@@ -0,0 +1,78 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeTwilio(t *testing.T) {
+	start := `{"event":"start","sequenceNumber":"1","start":{"accountSid":"AC1","streamSid":"MZ1","callSid":"CA1","tracks":["inbound"],"customParameters":{"caller_phone":"+48123456789"},"mediaFormat":{"encoding":"audio/x-mulaw","sampleRate":8000,"channels":1}},"streamSid":"MZ1"}`
+
+	msg, err := DecodeTwilio([]byte(start))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Start.CallSid != "CA1" || msg.Start.CustomParameters["caller_phone"] != "+48123456789" {
+		t.Errorf("unexpected start payload: %+v", msg.Start)
+	}
+	if msg.Start.MediaFormat.SampleRate != 8000 {
+		t.Errorf("unexpected sample rate: got %d want 8000", msg.Start.MediaFormat.SampleRate)
+	}
+
+	malformed := []string{
+		`not json`,
+		`{"streamSid":"MZ1"}`,
+		`{"event":"start"}`,
+		`{"event":"start","start":"oops"}`,
+		`{"event":"media","streamSid":"MZ1"}`,
+		`{"event":"dtmf"}`,
+	}
+	for _, m := range malformed {
+		if _, err := DecodeTwilio([]byte(m)); err == nil {
+			t.Errorf("expected error for %s", m)
+		}
+	}
+
+	if _, err := DecodeTwilio([]byte(`{"event":"something_new"}`)); err != nil {
+		t.Errorf("unknown events should decode, got %v", err)
+	}
+}
+
+func TestDecodeElevenLabs(t *testing.T) {
+	msg, err := DecodeElevenLabs([]byte(`{"type":"ping","ping_event":{"event_id":7,"ping_ms":40}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.Ping.EventID != 7 {
+		t.Errorf("unexpected event id: got %d want 7", msg.Ping.EventID)
+	}
+
+	msg, err = DecodeElevenLabs([]byte(`{"type":"client_tool_call","client_tool_call":{"tool_name":"opt_out","tool_call_id":"t1","parameters":{"channel":"sms"}}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg.ClientToolCall.ToolName != "opt_out" || msg.ClientToolCall.Parameters["channel"] != "sms" {
+		t.Errorf("unexpected tool call: %+v", msg.ClientToolCall)
+	}
+
+	malformed := []string{
+		`[]`,
+		`{"audio_event":{}}`,
+		`{"type":"audio"}`,
+		`{"type":"audio","audio_event":{"audio_base_64":5}}`,
+		`{"type":"conversation_initiation_metadata"}`,
+	}
+	for _, m := range malformed {
+		if _, err := DecodeElevenLabs([]byte(m)); err == nil {
+			t.Errorf("expected error for %s", m)
+		}
+	}
+}
+
+func TestTwilioOutbound(t *testing.T) {
+	data, _ := json.Marshal(NewTwilioMedia("MZ1", "AAAA"))
+	want := `{"event":"media","streamSid":"MZ1","media":{"payload":"AAAA"}}`
+	if string(data) != want {
+		t.Errorf("unexpected media frame: got %s want %s", data, want)
+	}
+}
@@ -0,0 +1,142 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Twilio Media Streams event names
+// https://www.twilio.com/docs/voice/media-streams/websocket-messages
+const (
+	TwilioEventConnected = "connected"
+	TwilioEventStart     = "start"
+	TwilioEventMedia     = "media"
+	TwilioEventMark      = "mark"
+	TwilioEventStop      = "stop"
+	TwilioEventDTMF      = "dtmf"
+	TwilioEventClear     = "clear"
+)
+
+// TwilioMessage is a single frame received from a Twilio media stream.
+// Only the field matching Event is populated.
+type TwilioMessage struct {
+	Event          string `json:"event"`
+	SequenceNumber string `json:"sequenceNumber,omitempty"`
+	StreamSid      string `json:"streamSid,omitempty"`
+
+	// connected
+	Protocol string `json:"protocol,omitempty"`
+	Version  string `json:"version,omitempty"`
+
+	Start *TwilioStart `json:"start,omitempty"`
+	Media *TwilioMedia `json:"media,omitempty"`
+	Mark  *TwilioMark  `json:"mark,omitempty"`
+	Stop  *TwilioStop  `json:"stop,omitempty"`
+	DTMF  *TwilioDTMF  `json:"dtmf,omitempty"`
+}
+
+type TwilioStart struct {
+	AccountSid       string            `json:"accountSid"`
+	StreamSid        string            `json:"streamSid"`
+	CallSid          string            `json:"callSid"`
+	Tracks           []string          `json:"tracks"`
+	CustomParameters map[string]string `json:"customParameters"`
+	MediaFormat      TwilioMediaFormat `json:"mediaFormat"`
+}
+
+type TwilioMediaFormat struct {
+	Encoding   string `json:"encoding"`
+	SampleRate int    `json:"sampleRate"`
+	Channels   int    `json:"channels"`
+}
+
+type TwilioMedia struct {
+	Track     string `json:"track,omitempty"`
+	Chunk     string `json:"chunk,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Payload   string `json:"payload"`
+}
+
+type TwilioMark struct {
+	Name string `json:"name"`
+}
+
+type TwilioStop struct {
+	AccountSid string `json:"accountSid"`
+	CallSid    string `json:"callSid"`
+}
+
+type TwilioDTMF struct {
+	Track string `json:"track"`
+	Digit string `json:"digit"`
+}
+
+// DecodeTwilio parses a media stream frame and checks that the payload
+// required by its event is present. Unknown events decode without error so
+// callers can ignore them.
+func DecodeTwilio(data []byte) (*TwilioMessage, error) {
+	var msg TwilioMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("invalid twilio message: %w", err)
+	}
+
+	switch msg.Event {
+	case "":
+		return nil, fmt.Errorf("invalid twilio message: missing event")
+	case TwilioEventStart:
+		if msg.Start == nil || msg.Start.StreamSid == "" {
+			return nil, fmt.Errorf("invalid twilio %s message: missing stream sid", msg.Event)
+		}
+		if msg.StreamSid == "" {
+			msg.StreamSid = msg.Start.StreamSid
+		}
+	case TwilioEventMedia:
+		if msg.Media == nil {
+			return nil, fmt.Errorf("invalid twilio %s message: missing media", msg.Event)
+		}
+	case TwilioEventMark:
+		if msg.Mark == nil {
+			return nil, fmt.Errorf("invalid twilio %s message: missing mark", msg.Event)
+		}
+	case TwilioEventDTMF:
+		if msg.DTMF == nil {
+			return nil, fmt.Errorf("invalid twilio %s message: missing dtmf", msg.Event)
+		}
+	}
+
+	return &msg, nil
+}
+
+// TwilioOutbound is a frame sent back to Twilio on the media stream.
+type TwilioOutbound struct {
+	Event     string       `json:"event"`
+	StreamSid string       `json:"streamSid"`
+	Media     *TwilioMedia `json:"media,omitempty"`
+	Mark      *TwilioMark  `json:"mark,omitempty"`
+}
+
+// NewTwilioMedia plays a base64 μ-law chunk to the caller.
+func NewTwilioMedia(streamSid, payload string) TwilioOutbound {
+	return TwilioOutbound{
+		Event:     TwilioEventMedia,
+		StreamSid: streamSid,
+		Media:     &TwilioMedia{Payload: payload},
+	}
+}
+
+// NewTwilioClear drops any audio Twilio has buffered for the caller.
+func NewTwilioClear(streamSid string) TwilioOutbound {
+	return TwilioOutbound{
+		Event:     TwilioEventClear,
+		StreamSid: streamSid,
+	}
+}
+
+// NewTwilioMark asks Twilio to echo a mark once preceding audio has played.
+func NewTwilioMark(streamSid, name string) TwilioOutbound {
+	return TwilioOutbound{
+		Event:     TwilioEventMark,
+		StreamSid: streamSid,
+		Mark:      &TwilioMark{Name: name},
+	}
+}
@@ -0,0 +1,58 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore keeps finished recordings.
+type BlobStore interface {
+	// Put stores the contents of r under key and returns where it can be
+	// found.
+	Put(ctx context.Context, key string, r io.Reader) (string, error)
+}
+
+// LocalStore writes recordings below a directory on local disk.
+type LocalStore struct {
+	Dir string
+}
+
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{Dir: dir}
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	clean := filepath.Clean(key)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid recording key %q", key)
+	}
+
+	path := filepath.Join(s.Dir, clean)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	// write to a temporary file first so readers never see a partial WAV
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".recording-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
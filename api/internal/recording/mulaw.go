@@ -0,0 +1,41 @@
+package recording
+
+// G.711 μ-law, the encoding Twilio media streams and the ElevenLabs
+// ulaw_8000 output format use.
+
+const (
+	SampleRate = 8000
+
+	// μ-law encoding of a zero sample
+	mulawSilence = 0xFF
+
+	mulawBias = 0x84
+)
+
+var mulawTable = func() [256]int16 {
+	var table [256]int16
+	for i := range table {
+		table[i] = decodeMulaw(byte(i))
+	}
+	return table
+}()
+
+func decodeMulaw(b byte) int16 {
+	b = ^b
+	sign := b & 0x80
+	exponent := (b >> 4) & 0x07
+	mantissa := b & 0x0F
+
+	sample := ((int32(mantissa) << 3) + mulawBias) << exponent
+	sample -= mulawBias
+
+	if sign != 0 {
+		return int16(-sample)
+	}
+	return int16(sample)
+}
+
+// DecodeMulaw converts a μ-law sample to 16-bit linear PCM.
+func DecodeMulaw(b byte) int16 {
+	return mulawTable[b]
+}
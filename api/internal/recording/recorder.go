@@ -0,0 +1,138 @@
+// Package recording turns the μ-law audio of a call into a stereo WAV file,
+// caller on the left channel and agent on the right.
+package recording
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// Recorder collects both sides of a call. Caller audio arrives from Twilio in
+// real time and is used as the clock; agent audio is streamed ahead of
+// playback, so each chunk is placed where Twilio would start playing it and
+// anything still queued at an interruption is dropped, as Twilio does.
+type Recorder struct {
+	mu     sync.Mutex
+	caller []byte
+	agent  []byte
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// AddCaller appends a base64 μ-law chunk from the Twilio media stream.
+func (r *Recorder) AddCaller(payload string) error {
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caller = append(r.caller, data...)
+	return nil
+}
+
+// AddAgent queues a base64 μ-law chunk of agent speech.
+func (r *Recorder) AddAgent(payload string) error {
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the agent stayed silent until now
+	for len(r.agent) < len(r.caller) {
+		r.agent = append(r.agent, mulawSilence)
+	}
+	r.agent = append(r.agent, data...)
+	return nil
+}
+
+// Interrupt drops agent speech that had not been played yet.
+func (r *Recorder) Interrupt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.agent) > len(r.caller) {
+		r.agent = r.agent[:len(r.caller)]
+	}
+}
+
+// Empty reports whether no audio was recorded.
+func (r *Recorder) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.caller) == 0 && len(r.agent) == 0
+}
+
+// WriteWAV writes the call as 16-bit PCM stereo at 8 kHz.
+func (r *Recorder) WriteWAV(w io.Writer) error {
+	r.mu.Lock()
+	caller := append([]byte(nil), r.caller...)
+	agent := append([]byte(nil), r.agent...)
+	r.mu.Unlock()
+
+	frames := len(caller)
+	if len(agent) > frames {
+		frames = len(agent)
+	}
+
+	const (
+		channels      = 2
+		bitsPerSample = 16
+		blockAlign    = channels * bitsPerSample / 8
+	)
+	dataSize := uint32(frames * blockAlign)
+
+	header := struct {
+		ChunkID       [4]byte
+		ChunkSize     uint32
+		Format        [4]byte
+		Subchunk1ID   [4]byte
+		Subchunk1Size uint32
+		AudioFormat   uint16
+		NumChannels   uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Subchunk2ID   [4]byte
+		Subchunk2Size uint32
+	}{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     36 + dataSize,
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   1, // PCM
+		NumChannels:   channels,
+		SampleRate:    SampleRate,
+		ByteRate:      SampleRate * blockAlign,
+		BlockAlign:    blockAlign,
+		BitsPerSample: bitsPerSample,
+		Subchunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+		Subchunk2Size: dataSize,
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	samples := make([]int16, 0, frames*channels)
+	for i := 0; i < frames; i++ {
+		samples = append(samples, sampleAt(caller, i), sampleAt(agent, i))
+	}
+	return binary.Write(w, binary.LittleEndian, samples)
+}
+
+func sampleAt(track []byte, i int) int16 {
+	if i >= len(track) {
+		return 0
+	}
+	return DecodeMulaw(track[i])
+}
@@ -0,0 +1,76 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDecodeMulaw(t *testing.T) {
+	cases := map[byte]int16{
+		0xFF: 0,
+		0x7F: 0,
+		0x80: 32124,
+		0x00: -32124,
+		0xF0: 120,
+	}
+	for in, want := range cases {
+		if got := DecodeMulaw(in); got != want {
+			t.Errorf("DecodeMulaw(%#x) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func chunk(b ...byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestRecorderWAV(t *testing.T) {
+	r := NewRecorder()
+
+	// two caller samples, then the agent answers with three samples of which
+	// the last one is cut off by an interruption
+	r.AddCaller(chunk(0x80, 0x80))
+	r.AddAgent(chunk(0x00, 0x00, 0x00))
+	r.AddCaller(chunk(0xFF, 0xFF))
+	r.Interrupt()
+	if err := r.AddCaller("not base64!"); err == nil {
+		t.Error("expected error for invalid payload")
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteWAV(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" || string(data[36:40]) != "data" {
+		t.Fatalf("invalid WAV header: %q", data[:44])
+	}
+	if channels := binary.LittleEndian.Uint16(data[22:24]); channels != 2 {
+		t.Errorf("channels: got %d want 2", channels)
+	}
+	if rate := binary.LittleEndian.Uint32(data[24:28]); rate != SampleRate {
+		t.Errorf("sample rate: got %d want %d", rate, SampleRate)
+	}
+
+	samples := make([]int16, (len(data)-44)/2)
+	binary.Read(bytes.NewReader(data[44:]), binary.LittleEndian, samples)
+
+	// interleaved left (caller), right (agent)
+	want := []int16{
+		32124, 0,
+		32124, 0,
+		0, -32124,
+		0, -32124,
+	}
+	if len(samples) != len(want) {
+		t.Fatalf("got %d samples, want %d", len(samples), len(want))
+	}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d: got %d want %d", i, samples[i], want[i])
+		}
+	}
+}
@@ -4,9 +4,15 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"claimsio/internal/api"
+	"claimsio/internal/compliance"
 	"claimsio/internal/config"
+	"claimsio/internal/debtor"
+	"claimsio/internal/n8n"
+	"claimsio/internal/payments"
+	"claimsio/internal/store"
 
 	"github.com/gorilla/websocket"
 )
@@ -15,19 +21,60 @@ type Server struct {
 	cfg      *config.Config
 	srv      *http.Server
 	upgrader websocket.Upgrader
+	store    store.Store
+	n8n      *n8n.Client
+	debtors  debtor.Resolver
+	contacts *compliance.Engine
+	payments *payments.Service
+
+	// stops the n8n outbox redelivery loop
+	stopOutbox context.CancelFunc
 }
 
 func New(cfg *config.Config) (*Server, error) {
 	s := &Server{
 		cfg: cfg,
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // allow all origins for now
-			},
-		},
+		// Twilio sends no Origin header; the default check still turns away
+		// cross-site browser connections
+		upgrader: websocket.Upgrader{},
+	}
+
+	st, err := store.New(cfg.Store, cfg.SupabasePgURL)
+	if err != nil {
+		return nil, err
+	}
+	s.store = st
+	fmt.Printf("[Server] Using %s store\n", cfg.Store)
+
+	s.n8n = n8n.New(cfg.N8NBaseURL, cfg.N8NAuthToken)
+	s.n8n.Secret = cfg.N8NWebhookSecret
+	s.n8n.HTTPClient.Timeout = cfg.N8NTimeout
+	outbox, err := n8n.NewFileOutbox(cfg.N8NOutboxDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open n8n outbox: %w", err)
+	}
+	s.n8n.Outbox = outbox
+
+	debtors, err := newDebtorResolver(cfg, s.store, s.n8n)
+	if err != nil {
+		return nil, err
+	}
+	s.debtors = debtor.NewCached(debtors, cfg.DebtorCacheTTL)
+
+	rules, err := compliance.LoadRules(cfg.ComplianceRulesFile)
+	if err != nil {
+		return nil, err
 	}
+	s.contacts = compliance.NewEngine(rules, s.store, s.store)
 
-	router := api.NewRouter(s.cfg, s.upgrader)
+	profiles, err := payments.LoadProfiles(cfg.CreditorProfilesFile)
+	if err != nil {
+		return nil, err
+	}
+	s.payments = payments.NewService(cfg.StripeAPIKeyTest, cfg.StripeAPIKeyLive, nil)
+	s.payments.Profiles = profiles
+
+	router := api.NewRouter(s.cfg, s.upgrader, s.store, s.n8n, s.debtors, s.contacts, s.payments)
 	s.srv = &http.Server{
 		Addr:    fmt.Sprintf(":%s", cfg.Port),
 		Handler: router,
@@ -37,10 +84,33 @@ func New(cfg *config.Config) (*Server, error) {
 }
 
 func (s *Server) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopOutbox = cancel
+	go s.n8n.RunOutbox(ctx, time.Minute)
+
 	fmt.Printf("[Server] Listening on port %s\n", s.cfg.Port)
 	return s.srv.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.srv.Shutdown(ctx)
+	if s.stopOutbox != nil {
+		s.stopOutbox()
+	}
+	if err := s.srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	return s.store.Close()
+}
+
+// newDebtorResolver picks where debtors are looked up. The Postgres resolver
+// shares the store's connection pool.
+func newDebtorResolver(cfg *config.Config, st store.Store, hooks *n8n.Client) (debtor.Resolver, error) {
+	if cfg.DebtorResolver != "postgres" {
+		return debtor.NewN8N(hooks), nil
+	}
+	pg, ok := st.(*store.Postgres)
+	if !ok {
+		return nil, fmt.Errorf("DEBTOR_RESOLVER=postgres requires SUPABASE_PG_URL")
+	}
+	return debtor.NewPostgres(pg.DB()), nil
 }
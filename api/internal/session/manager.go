@@ -0,0 +1,128 @@
+package session
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Manager tracks live calls. Sessions can be looked up by call SID, stream
+// SID or ElevenLabs conversation ID.
+type Manager struct {
+	mu    sync.RWMutex
+	index map[string]*CallSession
+	calls map[*CallSession]struct{}
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		index: make(map[string]*CallSession),
+		calls: make(map[*CallSession]struct{}),
+	}
+}
+
+// Start registers a call whose media stream has just started.
+func (m *Manager) Start(direction Direction, callSid, streamSid, phone string) *CallSession {
+	s := &CallSession{
+		direction: direction,
+		callSid:   callSid,
+		streamSid: streamSid,
+		phone:     phone,
+		state:     StateConnecting,
+		createdAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls[s] = struct{}{}
+	m.indexLocked(s, callSid, streamSid)
+
+	return s
+}
+
+// Get finds a live call by any of its identifiers.
+func (m *Manager) Get(id string) (*CallSession, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.index[id]
+	return s, ok
+}
+
+// Activate marks the agent as connected.
+func (m *Manager) Activate(s *CallSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.transition(StateActive); err != nil {
+		return err
+	}
+	s.activeAt = time.Now()
+	return nil
+}
+
+// SetConversationID records the ElevenLabs conversation and makes the
+// session reachable by it.
+func (m *Manager) SetConversationID(s *CallSession, conversationID string) {
+	s.mu.Lock()
+	s.conversationID = conversationID
+	s.mu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, live := m.calls[s]; live {
+		m.indexLocked(s, conversationID)
+	}
+}
+
+// End moves the session to its final state and forgets it. Only the first
+// call for a session reports ok, so callers can run end-of-call work from
+// both the stop event and a deferred cleanup without doing it twice.
+func (m *Manager) End(s *CallSession, reason string) (Snapshot, bool) {
+	s.mu.Lock()
+	if s.state == StateEnded {
+		s.mu.Unlock()
+		return s.Snapshot(), false
+	}
+	s.transition(StateEnded)
+	s.endReason = reason
+	s.endedAt = time.Now()
+	s.mu.Unlock()
+
+	m.mu.Lock()
+	delete(m.calls, s)
+	for id, indexed := range m.index {
+		if indexed == s {
+			delete(m.index, id)
+		}
+	}
+	m.mu.Unlock()
+
+	return s.Snapshot(), true
+}
+
+// Active lists live calls, oldest first.
+func (m *Manager) Active() []Snapshot {
+	m.mu.RLock()
+	snapshots := make([]Snapshot, 0, len(m.calls))
+	for s := range m.calls {
+		snapshots = append(snapshots, s.Snapshot())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+
+	return snapshots
+}
+
+func (m *Manager) indexLocked(s *CallSession, ids ...string) {
+	for _, id := range ids {
+		if id != "" {
+			m.index[id] = s
+		}
+	}
+}
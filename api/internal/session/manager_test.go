@@ -0,0 +1,58 @@
+package session
+
+import "testing"
+
+func TestManagerLifecycle(t *testing.T) {
+	m := NewManager()
+
+	s := m.Start(Outbound, "CA1", "MZ1", "+48123456789")
+	s.SetUserData(map[string]interface{}{"debtor_id": "debtor123"})
+
+	if err := m.Activate(s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m.SetConversationID(s, "conv1")
+
+	for _, id := range []string{"CA1", "MZ1", "conv1"} {
+		if got, ok := m.Get(id); !ok || got != s {
+			t.Errorf("session not found by %s", id)
+		}
+	}
+
+	if active := m.Active(); len(active) != 1 || active[0].DebtorID != "debtor123" {
+		t.Errorf("unexpected active calls: %+v", active)
+	}
+
+	call, ok := m.End(s, EndReasonCompleted)
+	if !ok {
+		t.Fatal("expected first End to report ok")
+	}
+	if call.State != StateEnded || call.ConversationID != "conv1" || call.EndReason != EndReasonCompleted {
+		t.Errorf("unexpected final snapshot: %+v", call)
+	}
+
+	if _, ok := m.End(s, EndReasonDisconnected); ok {
+		t.Error("expected second End to be a no-op")
+	}
+	if s.Snapshot().EndReason != EndReasonCompleted {
+		t.Error("second End must not overwrite the end reason")
+	}
+
+	if _, ok := m.Get("MZ1"); ok {
+		t.Error("ended session is still indexed")
+	}
+	if len(m.Active()) != 0 {
+		t.Error("ended session is still listed as active")
+	}
+}
+
+func TestInvalidTransition(t *testing.T) {
+	m := NewManager()
+
+	s := m.Start(Inbound, "CA1", "MZ1", "+48123456789")
+	m.End(s, EndReasonAgentFailed)
+
+	if err := m.Activate(s); err == nil {
+		t.Error("expected error activating an ended call")
+	}
+}
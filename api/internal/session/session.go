@@ -0,0 +1,168 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type Direction string
+
+const (
+	Inbound  Direction = "inbound"
+	Outbound Direction = "outbound"
+)
+
+type State string
+
+const (
+	// media stream started, agent not connected yet
+	StateConnecting State = "connecting"
+	// caller and agent are talking
+	StateActive State = "active"
+	StateEnded  State = "ended"
+)
+
+// allowed state transitions
+var transitions = map[State][]State{
+	StateConnecting: {StateActive, StateEnded},
+	StateActive:     {StateEnded},
+}
+
+// Transcript speakers
+const (
+	SpeakerAgent = "agent"
+	SpeakerUser  = "user"
+)
+
+// Turn is one transcribed utterance.
+type Turn struct {
+	Speaker   string    `json:"speaker"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// End reasons reported in webhooks and call records
+const (
+	EndReasonCompleted    = "completed"
+	EndReasonDisconnected = "disconnected"
+	EndReasonAgentFailed  = "agent_failed"
+)
+
+// CallSession holds the state of a single phone call. It is safe for
+// concurrent use; read it through Snapshot.
+type CallSession struct {
+	mu sync.RWMutex
+
+	direction      Direction
+	callSid        string
+	streamSid      string
+	conversationID string
+	debtorID       string
+	phone          string
+	userData       map[string]interface{}
+	transcript     []Turn
+
+	state     State
+	endReason string
+	createdAt time.Time
+	activeAt  time.Time
+	endedAt   time.Time
+}
+
+// Snapshot is a point-in-time copy of a CallSession.
+type Snapshot struct {
+	Direction      Direction              `json:"direction"`
+	CallSid        string                 `json:"call_sid"`
+	StreamSid      string                 `json:"stream_sid"`
+	ConversationID string                 `json:"conversation_id,omitempty"`
+	DebtorID       string                 `json:"debtor_id,omitempty"`
+	Phone          string                 `json:"phone"`
+	UserData       map[string]interface{} `json:"-"`
+	State          State                  `json:"state"`
+	EndReason      string                 `json:"end_reason,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	ActiveAt       time.Time              `json:"active_at"`
+	EndedAt        time.Time              `json:"ended_at"`
+}
+
+// Duration is the time from stream start to hang-up, or until now for
+// calls that are still running.
+func (s Snapshot) Duration() time.Duration {
+	if s.EndedAt.IsZero() {
+		return time.Since(s.CreatedAt)
+	}
+	return s.EndedAt.Sub(s.CreatedAt)
+}
+
+func (s *CallSession) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return Snapshot{
+		Direction:      s.direction,
+		CallSid:        s.callSid,
+		StreamSid:      s.streamSid,
+		ConversationID: s.conversationID,
+		DebtorID:       s.debtorID,
+		Phone:          s.phone,
+		UserData:       s.userData,
+		State:          s.state,
+		EndReason:      s.endReason,
+		CreatedAt:      s.createdAt,
+		ActiveAt:       s.activeAt,
+		EndedAt:        s.endedAt,
+	}
+}
+
+func (s *CallSession) CallSid() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.callSid
+}
+
+func (s *CallSession) State() State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// SetUserData stores the debtor record resolved for this call.
+func (s *CallSession) SetUserData(userData map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.userData = userData
+	if debtorID, ok := userData["debtor_id"].(string); ok {
+		s.debtorID = debtorID
+	}
+}
+
+// AddTurn appends an utterance to the call transcript.
+func (s *CallSession) AddTurn(speaker, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.transcript = append(s.transcript, Turn{
+		Speaker:   speaker,
+		Text:      text,
+		Timestamp: time.Now(),
+	})
+}
+
+// Transcript returns a copy of the turns recorded so far.
+func (s *CallSession) Transcript() []Turn {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Turn{}, s.transcript...)
+}
+
+func (s *CallSession) transition(to State) error {
+	for _, allowed := range transitions[s.state] {
+		if allowed == to {
+			s.state = to
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid call state transition: %s -> %s", s.state, to)
+}
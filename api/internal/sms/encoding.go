@@ -0,0 +1,100 @@
+// Package sms works out how a text is encoded and split into billed SMS
+// segments.
+package sms
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+type Encoding string
+
+const (
+	GSM7 Encoding = "GSM-7"
+	UCS2 Encoding = "UCS-2"
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet, one septet per character.
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension characters are sent as an escape plus a septet.
+const gsm7Extension = "^{}\\[~]|€\f"
+
+// Segment sizes in characters for single and concatenated messages; the
+// user data header of a concatenated message takes the difference.
+const (
+	gsm7Single = 160
+	gsm7Multi  = 153
+	ucs2Single = 70
+	ucs2Multi  = 67
+)
+
+// Info describes how a text will be sent.
+type Info struct {
+	Encoding Encoding `json:"encoding"`
+	// septets for GSM-7, UTF-16 code units for UCS-2
+	Length   int `json:"length"`
+	Segments int `json:"segments"`
+}
+
+// Analyze returns the encoding Twilio will use for text and the number of
+// segments it will be billed as.
+func Analyze(text string) Info {
+	if length, ok := gsm7Length(text); ok {
+		return Info{Encoding: GSM7, Length: length, Segments: segments(length, gsm7Single, gsm7Multi)}
+	}
+	length := len(utf16.Encode([]rune(text)))
+	return Info{Encoding: UCS2, Length: length, Segments: segments(length, ucs2Single, ucs2Multi)}
+}
+
+func gsm7Length(text string) (int, bool) {
+	length := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			length++
+		case strings.ContainsRune(gsm7Extension, r):
+			length += 2
+		default:
+			return 0, false
+		}
+	}
+	return length, true
+}
+
+func segments(length, single, multi int) int {
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
+
+// transliterations replace characters outside GSM-7 that have a close
+// equivalent, Polish diacritics first.
+var transliterations = map[rune]string{
+	'ą': "a", 'ć': "c", 'ę': "e", 'ł': "l", 'ń': "n", 'ó': "o", 'ś': "s", 'ź': "z", 'ż': "z",
+	'Ą': "A", 'Ć': "C", 'Ę': "E", 'Ł': "L", 'Ń': "N", 'Ó': "O", 'Ś': "S", 'Ź': "Z", 'Ż': "Z",
+	'á': "a", 'â': "a", 'ã': "a", 'č': "c", 'ď': "d", 'ě': "e", 'ê': "e", 'ë': "e", 'í': "i",
+	'î': "i", 'ï': "i", 'ň': "n", 'ô': "o", 'õ': "o", 'ř': "r", 'š': "s", 'ť': "t", 'ú': "u",
+	'ů': "u", 'û': "u", 'ý': "y", 'ž': "z",
+	'Á': "A", 'Â': "A", 'Č': "C", 'Ď': "D", 'Ě': "E", 'È': "E", 'Í': "I", 'Ň': "N", 'Ô': "O",
+	'Ř': "R", 'Š': "S", 'Ť': "T", 'Ú': "U", 'Ů': "U", 'Ý': "Y", 'Ž': "Z",
+	'‘': "'", '’': "'", '‚': "'", '“': "\"", '”': "\"", '„': "\"", '«': "\"", '»': "\"",
+	'–': "-", '—': "-", '…': "...", ' ': " ", '\t': " ",
+}
+
+// Transliterate replaces characters that would force UCS-2 with their
+// closest GSM-7 form. Characters without one are kept, so the result may
+// still need UCS-2.
+func Transliterate(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if s, ok := transliterations[r]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
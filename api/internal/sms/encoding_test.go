@@ -0,0 +1,38 @@
+package sms
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		text string
+		want Info
+	}{
+		{text: "Hello", want: Info{Encoding: GSM7, Length: 5, Segments: 1}},
+		{text: strings.Repeat("a", 160), want: Info{Encoding: GSM7, Length: 160, Segments: 1}},
+		{text: strings.Repeat("a", 161), want: Info{Encoding: GSM7, Length: 161, Segments: 2}},
+		{text: strings.Repeat("€", 80), want: Info{Encoding: GSM7, Length: 160, Segments: 1}},
+		{text: "Dzień dobry", want: Info{Encoding: UCS2, Length: 11, Segments: 1}},
+		{text: strings.Repeat("ż", 71), want: Info{Encoding: UCS2, Length: 71, Segments: 2}},
+		{text: strings.Repeat("ż", 135), want: Info{Encoding: UCS2, Length: 135, Segments: 3}},
+		{text: "😀", want: Info{Encoding: UCS2, Length: 2, Segments: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := Analyze(tt.text); got != tt.want {
+			t.Errorf("Analyze(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	got := Transliterate("Zażółć gęślą jaźń – „Łódź”")
+	if want := "Zazolc gesla jazn - \"Lodz\""; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if info := Analyze(got); info.Encoding != GSM7 {
+		t.Errorf("transliterated text still needs %s", info.Encoding)
+	}
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Call is a row in the calls table.
+type Call struct {
+	CallSid         string     `json:"call_sid"`
+	Direction       string     `json:"direction"`
+	StreamSid       string     `json:"stream_sid"`
+	DebtorID        string     `json:"debtor_id,omitempty"`
+	Phone           string     `json:"phone"`
+	ConversationID  string     `json:"conversation_id,omitempty"`
+	EndReason       string     `json:"end_reason,omitempty"`
+	DurationSeconds int        `json:"duration_seconds"`
+	RecordingURL    string     `json:"recording_url,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+}
+
+// CallEnd is recorded when the caller hangs up.
+type CallEnd struct {
+	ConversationID string
+	Duration       time.Duration
+	EndReason      string
+	EndedAt        time.Time
+	RecordingURL   string
+}
+
+type CallStore interface {
+	CreateCall(ctx context.Context, call *Call) error
+	FinishCall(ctx context.Context, callSid string, end CallEnd) error
+	GetCall(ctx context.Context, callSid string) (*Call, error)
+}
+
+func (p *Postgres) CreateCall(ctx context.Context, call *Call) error {
+	_, err := p.sb.Insert("calls").
+		Columns("call_sid", "direction", "stream_sid", "debtor_id", "phone", "started_at").
+		Values(call.CallSid, call.Direction, call.StreamSid, nullString(call.DebtorID), call.Phone, call.StartedAt).
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) FinishCall(ctx context.Context, callSid string, end CallEnd) error {
+	_, err := p.sb.Update("calls").
+		Set("conversation_id", nullString(end.ConversationID)).
+		Set("duration_seconds", int(end.Duration.Seconds())).
+		Set("end_reason", end.EndReason).
+		Set("ended_at", end.EndedAt).
+		Set("recording_url", nullString(end.RecordingURL)).
+		Where(sq.Eq{"call_sid": callSid}).
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) GetCall(ctx context.Context, callSid string) (*Call, error) {
+	var call Call
+	var debtorID, conversationID, endReason, recordingURL sql.NullString
+	var duration sql.NullInt64
+	var endedAt sql.NullTime
+
+	err := p.sb.Select("call_sid", "direction", "stream_sid", "debtor_id", "phone",
+		"conversation_id", "end_reason", "duration_seconds", "started_at", "ended_at", "recording_url").
+		From("calls").
+		Where(sq.Eq{"call_sid": callSid}).
+		QueryRowContext(ctx).
+		Scan(&call.CallSid, &call.Direction, &call.StreamSid, &debtorID, &call.Phone,
+			&conversationID, &endReason, &duration, &call.StartedAt, &endedAt, &recordingURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	call.DebtorID = debtorID.String
+	call.ConversationID = conversationID.String
+	call.EndReason = endReason.String
+	call.DurationSeconds = int(duration.Int64)
+	call.RecordingURL = recordingURL.String
+	if endedAt.Valid {
+		call.EndedAt = &endedAt.Time
+	}
+
+	return &call, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
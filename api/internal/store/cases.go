@@ -0,0 +1,42 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type CaseStore interface {
+	// SetCaseCreditor records the creditor a case is collected for,
+	// replacing any earlier one.
+	SetCaseCreditor(ctx context.Context, caseID, creditorID string) error
+	// GetCaseCreditor returns ErrNotFound for cases without a creditor.
+	GetCaseCreditor(ctx context.Context, caseID string) (string, error)
+}
+
+func (p *Postgres) SetCaseCreditor(ctx context.Context, caseID, creditorID string) error {
+	_, err := p.sb.Insert("case_creditors").
+		Columns("case_id", "creditor_id", "updated_at").
+		Values(caseID, creditorID, time.Now().UTC()).
+		Suffix(`ON CONFLICT (case_id) DO UPDATE SET
+			creditor_id = EXCLUDED.creditor_id,
+			updated_at = EXCLUDED.updated_at`).
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) GetCaseCreditor(ctx context.Context, caseID string) (string, error) {
+	var creditorID string
+	err := p.sb.Select("creditor_id").
+		From("case_creditors").
+		Where(sq.Eq{"case_id": caseID}).
+		QueryRowContext(ctx).
+		Scan(&creditorID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return creditorID, err
+}
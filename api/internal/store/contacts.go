@@ -0,0 +1,43 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Contact is an outbound call or SMS placed to a debtor, kept to enforce
+// contact caps.
+type Contact struct {
+	Phone   string `json:"phone"`
+	Channel string `json:"channel"`
+	// Twilio call or message sid
+	Reference   string    `json:"reference,omitempty"`
+	ContactedAt time.Time `json:"contacted_at"`
+}
+
+type ContactStore interface {
+	RecordContact(ctx context.Context, contact *Contact) error
+	// CountContacts counts contacts with phone on channel at or after since.
+	CountContacts(ctx context.Context, phone, channel string, since time.Time) (int, error)
+}
+
+func (p *Postgres) RecordContact(ctx context.Context, contact *Contact) error {
+	_, err := p.sb.Insert("contacts").
+		Columns("phone", "channel", "reference", "contacted_at").
+		Values(contact.Phone, contact.Channel, nullString(contact.Reference), contact.ContactedAt).
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) CountContacts(ctx context.Context, phone, channel string, since time.Time) (int, error) {
+	var count int
+	err := p.sb.Select("COUNT(*)").
+		From("contacts").
+		Where(sq.Eq{"phone": phone, "channel": channel}).
+		Where(sq.GtOrEq{"contacted_at": since}).
+		QueryRowContext(ctx).
+		Scan(&count)
+	return count, err
+}
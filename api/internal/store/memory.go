@@ -0,0 +1,390 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Memory is a Store kept in process memory. Data is lost on restart.
+type Memory struct {
+	mu          sync.RWMutex
+	calls       map[string]Call
+	transcripts map[string][]TranscriptTurn
+	contacts    []Contact
+	optOuts     map[string]OptOut
+	messages    []Message
+	payments    map[string]Payment
+	links       []PaymentLink
+	plans       []PaymentPlan
+	creditors   map[string]string
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		calls:       make(map[string]Call),
+		transcripts: make(map[string][]TranscriptTurn),
+		optOuts:     make(map[string]OptOut),
+		payments:    make(map[string]Payment),
+		creditors:   make(map[string]string),
+	}
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) CreateCall(ctx context.Context, call *Call) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.calls[call.CallSid]; exists {
+		return fmt.Errorf("call %s already exists", call.CallSid)
+	}
+	m.calls[call.CallSid] = *call
+	return nil
+}
+
+func (m *Memory) FinishCall(ctx context.Context, callSid string, end CallEnd) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	call, ok := m.calls[callSid]
+	if !ok {
+		return nil
+	}
+	call.ConversationID = end.ConversationID
+	call.DurationSeconds = int(end.Duration.Seconds())
+	call.EndReason = end.EndReason
+	call.RecordingURL = end.RecordingURL
+	endedAt := end.EndedAt
+	call.EndedAt = &endedAt
+	m.calls[callSid] = call
+	return nil
+}
+
+func (m *Memory) GetCall(ctx context.Context, callSid string) (*Call, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	call, ok := m.calls[callSid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &call, nil
+}
+
+func (m *Memory) SaveTranscript(ctx context.Context, callSid string, turns []TranscriptTurn) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.transcripts[callSid] = append([]TranscriptTurn(nil), turns...)
+	return nil
+}
+
+func (m *Memory) GetTranscript(ctx context.Context, callSid string) ([]TranscriptTurn, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]TranscriptTurn{}, m.transcripts[callSid]...), nil
+}
+
+func (m *Memory) RecordContact(ctx context.Context, contact *Contact) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.contacts = append(m.contacts, *contact)
+	return nil
+}
+
+func (m *Memory) CountContacts(ctx context.Context, phone, channel string, since time.Time) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, c := range m.contacts {
+		if c.Phone == phone && c.Channel == channel && !c.ContactedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) AddOptOut(ctx context.Context, optOut *OptOut) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := optOut.Phone + "/" + optOut.Channel
+	if _, exists := m.optOuts[key]; !exists {
+		m.optOuts[key] = *optOut
+	}
+	return nil
+}
+
+func (m *Memory) GetOptOut(ctx context.Context, phone, channel string) (*OptOut, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	optOut, ok := m.optOuts[phone+"/"+channel]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &optOut, nil
+}
+
+func (m *Memory) RemoveOptOut(ctx context.Context, phone, channel string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.optOuts, phone+"/"+channel)
+	return nil
+}
+
+func (m *Memory) SaveMessage(ctx context.Context, message *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if message.MessageSid != "" {
+		for _, existing := range m.messages {
+			if existing.MessageSid == message.MessageSid {
+				return nil
+			}
+		}
+	}
+	m.messages = append(m.messages, *message)
+	return nil
+}
+
+func (m *Memory) UpdateMessageStatus(ctx context.Context, messageSid string, status MessageStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, message := range m.messages {
+		if message.MessageSid != messageSid || isFinalMessageStatus(message.Status) {
+			continue
+		}
+		updatedAt := status.UpdatedAt
+		m.messages[i].Status = status.Status
+		m.messages[i].ErrorCode = status.ErrorCode
+		m.messages[i].StatusUpdatedAt = &updatedAt
+	}
+	return nil
+}
+
+func (m *Memory) ListMessages(ctx context.Context, phone string) ([]Message, error) {
+	return m.listMessages(func(message Message) bool { return message.Phone == phone }), nil
+}
+
+func (m *Memory) ListDebtorMessages(ctx context.Context, debtorID string) ([]Message, error) {
+	return m.listMessages(func(message Message) bool { return message.DebtorID == debtorID }), nil
+}
+
+func (m *Memory) listMessages(match func(Message) bool) []Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	messages := []Message{}
+	for _, message := range m.messages {
+		if match(message) {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
+
+func (m *Memory) SavePayment(ctx context.Context, payment *Payment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.payments[payment.PaymentIntentID]; ok {
+		m.payments[payment.PaymentIntentID] = stored.merge(*payment)
+		return nil
+	}
+	m.payments[payment.PaymentIntentID] = *payment
+	return nil
+}
+
+func (m *Memory) GetPayment(ctx context.Context, paymentIntentID string) (*Payment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	payment, ok := m.payments[paymentIntentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &payment, nil
+}
+
+func (m *Memory) SavePaymentLink(ctx context.Context, link *PaymentLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.links {
+		if stored.ID == link.ID {
+			return nil
+		}
+	}
+	m.links = append(m.links, *link)
+	return nil
+}
+
+func (m *Memory) FindPaymentLink(ctx context.Context, caseID, creditorID string, amount int64, currency, environment string) (*PaymentLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(m.links) - 1; i >= 0; i-- {
+		link := m.links[i]
+		if link.CaseID == caseID && link.CreditorID == creditorID && link.Amount == amount && link.Currency == currency &&
+			link.Environment == environment && link.Active && link.PaymentPlanID == "" {
+			return &link, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) FindPrice(ctx context.Context, amount int64, currency, environment, productName string) (string, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, link := range m.links {
+		if link.Amount == amount && link.Currency == currency && link.Environment == environment &&
+			link.ProductName == productName {
+			return link.ProductID, link.PriceID, nil
+		}
+	}
+	return "", "", ErrNotFound
+}
+
+func (m *Memory) FindProduct(ctx context.Context, environment, productName string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, link := range m.links {
+		if link.Environment == environment && link.ProductName == productName {
+			return link.ProductID, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (m *Memory) DeactivatePaymentLink(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.links {
+		if m.links[i].ID == id {
+			m.links[i].Active = false
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CountInactivePaymentLinks(ctx context.Context, caseID, environment string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, link := range m.links {
+		if link.CaseID == caseID && link.Environment == environment && !link.Active && link.PaymentPlanID == "" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) CreatePaymentPlan(ctx context.Context, plan *PaymentPlan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.plans {
+		if stored.ID == plan.ID {
+			return nil
+		}
+	}
+	m.plans = append(m.plans, plan.clone())
+	return nil
+}
+
+func (m *Memory) GetPaymentPlan(ctx context.Context, id string) (*PaymentPlan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, plan := range m.plans {
+		if plan.ID == id {
+			plan = plan.clone()
+			return &plan, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) ListCasePaymentPlans(ctx context.Context, caseID string) ([]PaymentPlan, error) {
+	return m.listPaymentPlans(func(plan PaymentPlan) bool { return plan.CaseID == caseID }), nil
+}
+
+func (m *Memory) ListDebtorPaymentPlans(ctx context.Context, debtorID string) ([]PaymentPlan, error) {
+	return m.listPaymentPlans(func(plan PaymentPlan) bool { return plan.DebtorID == debtorID }), nil
+}
+
+func (m *Memory) UpdateInstallmentStatus(ctx context.Context, paymentLinkID, status string, at time.Time) (*PaymentPlan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.plans {
+		plan := &m.plans[i]
+		for j := range plan.Installments {
+			in := &plan.Installments[j]
+			if in.PaymentLinkID != paymentLinkID {
+				continue
+			}
+
+			if in.Status != InstallmentPaid {
+				in.Status = status
+				if status == InstallmentPaid {
+					paidAt := at
+					in.PaidAt = &paidAt
+				}
+			}
+			if plan.paid() {
+				plan.Status = PaymentPlanCompleted
+			}
+
+			updated := plan.clone()
+			return &updated, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) listPaymentPlans(match func(PaymentPlan) bool) []PaymentPlan {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	plans := []PaymentPlan{}
+	for _, plan := range m.plans {
+		if match(plan) {
+			plans = append(plans, plan.clone())
+		}
+	}
+	return plans
+}
+
+func (m *Memory) SetCaseCreditor(ctx context.Context, caseID, creditorID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.creditors[caseID] = creditorID
+	return nil
+}
+
+func (m *Memory) GetCaseCreditor(ctx context.Context, caseID string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	creditorID, ok := m.creditors[caseID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return creditorID, nil
+}
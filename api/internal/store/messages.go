@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Twilio message statuses we track. Delivered, undelivered and failed are
+// final.
+const (
+	MessageQueued      = "queued"
+	MessageSent        = "sent"
+	MessageDelivered   = "delivered"
+	MessageUndelivered = "undelivered"
+	MessageFailed      = "failed"
+	MessageReceived    = "received"
+)
+
+// Message is an SMS sent to or received from a debtor.
+type Message struct {
+	MessageSid string `json:"message_sid"`
+	Direction  string `json:"direction"`
+	Phone      string `json:"phone"`
+	DebtorID   string `json:"debtor_id,omitempty"`
+	Body       string `json:"body"`
+	Status     string `json:"status,omitempty"`
+	// Twilio error code for failed and undelivered messages
+	ErrorCode       string     `json:"error_code,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StatusUpdatedAt *time.Time `json:"status_updated_at,omitempty"`
+}
+
+// MessageStatus is a delivery report from a Twilio status callback.
+type MessageStatus struct {
+	Status    string
+	ErrorCode string
+	UpdatedAt time.Time
+}
+
+type MessageStore interface {
+	// SaveMessage adds a message to its thread. A message whose SID is
+	// already stored is ignored, so webhook redeliveries are harmless.
+	SaveMessage(ctx context.Context, message *Message) error
+	// UpdateMessageStatus records a delivery report. Reports arriving after
+	// a final status are ignored.
+	UpdateMessageStatus(ctx context.Context, messageSid string, status MessageStatus) error
+	// ListMessages returns the SMS thread with phone, oldest first.
+	ListMessages(ctx context.Context, phone string) ([]Message, error)
+	// ListDebtorMessages returns every SMS exchanged with a debtor, oldest
+	// first.
+	ListDebtorMessages(ctx context.Context, debtorID string) ([]Message, error)
+}
+
+var finalMessageStatuses = []string{MessageDelivered, MessageUndelivered, MessageFailed}
+
+func (p *Postgres) SaveMessage(ctx context.Context, message *Message) error {
+	_, err := p.sb.Insert("messages").
+		Columns("message_sid", "direction", "phone", "debtor_id", "body", "status", "created_at").
+		Values(nullString(message.MessageSid), message.Direction, message.Phone,
+			nullString(message.DebtorID), message.Body, nullString(message.Status), message.CreatedAt).
+		Suffix("ON CONFLICT (message_sid) DO NOTHING").
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) UpdateMessageStatus(ctx context.Context, messageSid string, status MessageStatus) error {
+	_, err := p.sb.Update("messages").
+		Set("status", status.Status).
+		Set("error_code", nullString(status.ErrorCode)).
+		Set("status_updated_at", status.UpdatedAt).
+		Where(sq.Eq{"message_sid": messageSid}).
+		Where(sq.Or{sq.Eq{"status": nil}, sq.NotEq{"status": finalMessageStatuses}}).
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) ListMessages(ctx context.Context, phone string) ([]Message, error) {
+	return p.listMessages(ctx, sq.Eq{"phone": phone})
+}
+
+func (p *Postgres) ListDebtorMessages(ctx context.Context, debtorID string) ([]Message, error) {
+	return p.listMessages(ctx, sq.Eq{"debtor_id": debtorID})
+}
+
+func (p *Postgres) listMessages(ctx context.Context, where sq.Eq) ([]Message, error) {
+	rows, err := p.sb.Select("message_sid", "direction", "phone", "debtor_id", "body",
+		"status", "error_code", "created_at", "status_updated_at").
+		From("messages").
+		Where(where).
+		OrderBy("created_at", "id").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var message Message
+		var messageSid, debtorID, status, errorCode sql.NullString
+		var statusUpdatedAt sql.NullTime
+		if err := rows.Scan(&messageSid, &message.Direction, &message.Phone, &debtorID, &message.Body,
+			&status, &errorCode, &message.CreatedAt, &statusUpdatedAt); err != nil {
+			return nil, err
+		}
+		message.MessageSid = messageSid.String
+		message.DebtorID = debtorID.String
+		message.Status = status.String
+		message.ErrorCode = errorCode.String
+		if statusUpdatedAt.Valid {
+			message.StatusUpdatedAt = &statusUpdatedAt.Time
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+func isFinalMessageStatus(status string) bool {
+	for _, final := range finalMessageStatuses {
+		if status == final {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package store
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" {
+			t.Errorf("migration %s has an empty up body", m.Name)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %s has an empty down body", m.Name)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS calls (
+    call_sid         TEXT PRIMARY KEY,
+    direction        TEXT NOT NULL CHECK (direction IN ('inbound', 'outbound')),
+    stream_sid       TEXT NOT NULL,
+    debtor_id        TEXT,
+    phone            TEXT NOT NULL,
+    conversation_id  TEXT,
+    end_reason       TEXT,
+    duration_seconds INTEGER,
+    started_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS calls_debtor_id_idx ON calls (debtor_id);
+CREATE INDEX IF NOT EXISTS calls_phone_idx ON calls (phone);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS call_transcript_turns (
+    call_sid  TEXT NOT NULL REFERENCES calls (call_sid) ON DELETE CASCADE,
+    seq       INTEGER NOT NULL,
+    speaker   TEXT NOT NULL CHECK (speaker IN ('agent', 'user')),
+    text      TEXT NOT NULL,
+    spoken_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (call_sid, seq)
+);
@@ -0,0 +1 @@
+ALTER TABLE calls DROP COLUMN IF EXISTS recording_url;
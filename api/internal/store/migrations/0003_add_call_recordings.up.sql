@@ -0,0 +1 @@
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS recording_url TEXT;
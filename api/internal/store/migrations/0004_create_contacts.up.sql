@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS contacts (
+    id           BIGSERIAL PRIMARY KEY,
+    phone        TEXT NOT NULL,
+    channel      TEXT NOT NULL CHECK (channel IN ('call', 'sms')),
+    reference    TEXT,
+    contacted_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS contacts_phone_contacted_at_idx ON contacts (phone, contacted_at);
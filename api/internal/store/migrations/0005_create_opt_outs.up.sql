@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS opt_outs (
+    phone      TEXT NOT NULL,
+    channel    TEXT NOT NULL CHECK (channel IN ('call', 'sms')),
+    reason     TEXT,
+    source     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (phone, channel)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS messages (
+    id          BIGSERIAL PRIMARY KEY,
+    message_sid TEXT UNIQUE,
+    direction   TEXT NOT NULL CHECK (direction IN ('inbound', 'outbound')),
+    phone       TEXT NOT NULL,
+    debtor_id   TEXT,
+    body        TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS messages_phone_created_at_idx ON messages (phone, created_at);
+CREATE INDEX IF NOT EXISTS messages_debtor_id_idx ON messages (debtor_id);
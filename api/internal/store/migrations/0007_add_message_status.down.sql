@@ -0,0 +1,3 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS status_updated_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS error_code;
+ALTER TABLE messages DROP COLUMN IF EXISTS status;
@@ -0,0 +1,3 @@
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS status TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS error_code TEXT;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS status_updated_at TIMESTAMPTZ;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS payments (
+    payment_intent_id   TEXT PRIMARY KEY,
+    checkout_session_id TEXT,
+    payment_link_id     TEXT,
+    debtor_id           TEXT,
+    case_id             TEXT,
+    amount              BIGINT NOT NULL DEFAULT 0,
+    currency            TEXT,
+    status              TEXT NOT NULL CHECK (status IN ('pending', 'succeeded', 'failed')),
+    failure_message     TEXT,
+    updated_at          TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS payments_debtor_id_idx ON payments (debtor_id);
+CREATE INDEX IF NOT EXISTS payments_case_id_idx ON payments (case_id);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS payment_links (
+    id          TEXT PRIMARY KEY,
+    case_id     TEXT NOT NULL,
+    debtor_id   TEXT,
+    amount      BIGINT NOT NULL,
+    currency    TEXT NOT NULL,
+    environment TEXT NOT NULL,
+    url         TEXT NOT NULL,
+    product_id  TEXT NOT NULL,
+    price_id    TEXT NOT NULL,
+    active      BOOLEAN NOT NULL DEFAULT true,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS payment_links_case_id_idx ON payment_links (case_id, amount, currency);
+CREATE INDEX IF NOT EXISTS payment_links_price_idx ON payment_links (environment, amount, currency);
@@ -0,0 +1,3 @@
+ALTER TABLE payment_links DROP COLUMN IF EXISTS payment_plan_id;
+DROP TABLE IF EXISTS payment_installments;
+DROP TABLE IF EXISTS payment_plans;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS payment_plans (
+    id          TEXT PRIMARY KEY,
+    case_id     TEXT NOT NULL,
+    debtor_id   TEXT,
+    amount      BIGINT NOT NULL,
+    currency    TEXT NOT NULL,
+    environment TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS payment_plans_case_id_idx ON payment_plans (case_id);
+CREATE INDEX IF NOT EXISTS payment_plans_debtor_id_idx ON payment_plans (debtor_id);
+
+CREATE TABLE IF NOT EXISTS payment_installments (
+    plan_id         TEXT NOT NULL REFERENCES payment_plans (id) ON DELETE CASCADE,
+    number          INTEGER NOT NULL,
+    amount          BIGINT NOT NULL,
+    due_date        DATE NOT NULL,
+    status          TEXT NOT NULL,
+    payment_link_id TEXT NOT NULL UNIQUE,
+    payment_url     TEXT NOT NULL,
+    paid_at         TIMESTAMPTZ,
+    PRIMARY KEY (plan_id, number)
+);
+
+-- installment links are never reused for single payments
+ALTER TABLE payment_links ADD COLUMN IF NOT EXISTS payment_plan_id TEXT;
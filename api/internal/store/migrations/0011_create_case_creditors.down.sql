@@ -0,0 +1,2 @@
+ALTER TABLE payment_links DROP COLUMN IF EXISTS product_name;
+DROP TABLE IF EXISTS case_creditors;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS case_creditors (
+    case_id     TEXT PRIMARY KEY,
+    creditor_id TEXT NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- products are reused per name now that creditors may name their own
+ALTER TABLE payment_links ADD COLUMN IF NOT EXISTS product_name TEXT;
+UPDATE payment_links SET product_name = 'Debt payment' WHERE product_name IS NULL;
@@ -0,0 +1,3 @@
+-- links are only reused for the creditor they were issued for, earlier
+-- links were all issued under the default profile
+ALTER TABLE payment_links ADD COLUMN IF NOT EXISTS creditor_id TEXT NOT NULL DEFAULT 'default';
@@ -0,0 +1,3 @@
+-- the tables may hold admin panel data, only the lookup indexes are ours
+DROP INDEX IF EXISTS cases_debtor_id_idx;
+DROP INDEX IF EXISTS debtors_phone_digits_idx;
@@ -0,0 +1,22 @@
+-- debtors and cases belong to the admin panel; this is the part of their
+-- schema the Postgres debtor resolver reads, so a fresh database has it too
+-- and an existing one is left untouched
+CREATE TABLE IF NOT EXISTS debtors (
+    id         TEXT PRIMARY KEY,
+    first_name TEXT NOT NULL DEFAULT '',
+    last_name  TEXT NOT NULL DEFAULT '',
+    phone      TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS cases (
+    id          TEXT PRIMARY KEY,
+    debtor_id   TEXT NOT NULL REFERENCES debtors (id),
+    case_number TEXT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- phones are entered in any format, lookups compare the bare digits
+CREATE INDEX IF NOT EXISTS debtors_phone_digits_idx
+    ON debtors ((regexp_replace(regexp_replace(phone, '[^0-9]', '', 'g'), '^00', '')));
+CREATE INDEX IF NOT EXISTS cases_debtor_id_idx ON cases (debtor_id, created_at DESC);
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// OptOut records that a debtor must not be contacted on a channel again.
+type OptOut struct {
+	Phone   string `json:"phone"`
+	Channel string `json:"channel"`
+	Reason  string `json:"reason,omitempty"`
+	// how the opt-out was registered, e.g. "sms_keyword" or "agent"
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OptOutStore interface {
+	// AddOptOut registers an opt-out. Registering the same phone and channel
+	// again keeps the original record.
+	AddOptOut(ctx context.Context, optOut *OptOut) error
+	GetOptOut(ctx context.Context, phone, channel string) (*OptOut, error)
+	// RemoveOptOut lifts an opt-out, e.g. after the debtor texts START.
+	RemoveOptOut(ctx context.Context, phone, channel string) error
+}
+
+func (p *Postgres) AddOptOut(ctx context.Context, optOut *OptOut) error {
+	_, err := p.sb.Insert("opt_outs").
+		Columns("phone", "channel", "reason", "source", "created_at").
+		Values(optOut.Phone, optOut.Channel, nullString(optOut.Reason), optOut.Source, optOut.CreatedAt).
+		Suffix("ON CONFLICT (phone, channel) DO NOTHING").
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) RemoveOptOut(ctx context.Context, phone, channel string) error {
+	_, err := p.sb.Delete("opt_outs").
+		Where(sq.Eq{"phone": phone, "channel": channel}).
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) GetOptOut(ctx context.Context, phone, channel string) (*OptOut, error) {
+	optOut := OptOut{Phone: phone, Channel: channel}
+	var reason sql.NullString
+
+	err := p.sb.Select("reason", "source", "created_at").
+		From("opt_outs").
+		Where(sq.Eq{"phone": phone, "channel": channel}).
+		QueryRowContext(ctx).
+		Scan(&reason, &optOut.Source, &optOut.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	optOut.Reason = reason.String
+	return &optOut, nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// PaymentLink is a Stripe payment link issued for a case. Amount is in the
+// currency's minor unit.
+type PaymentLink struct {
+	ID          string    `json:"id"`
+	CaseID      string    `json:"case_id"`
+	DebtorID    string    `json:"debtor_id,omitempty"`
+	Amount      int64     `json:"amount"`
+	Currency    string    `json:"currency"`
+	Environment string    `json:"environment"`
+	URL         string    `json:"url"`
+	ProductID   string    `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	PriceID     string    `json:"price_id"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	// set for links issued for an installment of a payment plan
+	PaymentPlanID string `json:"payment_plan_id,omitempty"`
+	// creditor whose payment profile the link was issued with
+	CreditorID string `json:"creditor_id"`
+}
+
+type PaymentLinkStore interface {
+	// SavePaymentLink records an issued link. Saving a known link again is a
+	// no-op.
+	SavePaymentLink(ctx context.Context, link *PaymentLink) error
+	// FindPaymentLink returns the newest active link issued for a case and
+	// amount under the creditor's profile, skipping installment links.
+	FindPaymentLink(ctx context.Context, caseID, creditorID string, amount int64, currency, environment string) (*PaymentLink, error)
+	// FindPrice returns the product and price of any link issued for amount
+	// of the named product, so they can be reused for another case.
+	FindPrice(ctx context.Context, amount int64, currency, environment, productName string) (productID, priceID string, err error)
+	// FindProduct returns the product with the given name any link in
+	// environment was issued for.
+	FindProduct(ctx context.Context, environment, productName string) (string, error)
+	// DeactivatePaymentLink stops a link from being reused, e.g. once paid.
+	DeactivatePaymentLink(ctx context.Context, id string) error
+	// CountInactivePaymentLinks counts the deactivated links of a case,
+	// skipping installment links.
+	CountInactivePaymentLinks(ctx context.Context, caseID, environment string) (int, error)
+}
+
+func (p *Postgres) SavePaymentLink(ctx context.Context, link *PaymentLink) error {
+	_, err := p.sb.Insert("payment_links").
+		Columns("id", "case_id", "debtor_id", "amount", "currency", "environment", "url",
+			"product_id", "product_name", "price_id", "active", "created_at", "payment_plan_id", "creditor_id").
+		Values(link.ID, link.CaseID, nullString(link.DebtorID), link.Amount, link.Currency, link.Environment,
+			link.URL, link.ProductID, nullString(link.ProductName), link.PriceID, link.Active, link.CreatedAt,
+			nullString(link.PaymentPlanID), link.CreditorID).
+		Suffix("ON CONFLICT (id) DO NOTHING").
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) FindPaymentLink(ctx context.Context, caseID, creditorID string, amount int64, currency, environment string) (*PaymentLink, error) {
+	link := PaymentLink{CaseID: caseID, CreditorID: creditorID, Amount: amount, Currency: currency, Environment: environment}
+	var debtorID, productName sql.NullString
+
+	err := p.sb.Select("id", "debtor_id", "url", "product_id", "product_name", "price_id", "active", "created_at").
+		From("payment_links").
+		Where(sq.Eq{
+			"case_id":         caseID,
+			"creditor_id":     creditorID,
+			"amount":          amount,
+			"currency":        currency,
+			"environment":     environment,
+			"active":          true,
+			"payment_plan_id": nil,
+		}).
+		OrderBy("created_at DESC").
+		Limit(1).
+		QueryRowContext(ctx).
+		Scan(&link.ID, &debtorID, &link.URL, &link.ProductID, &productName, &link.PriceID, &link.Active, &link.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	link.DebtorID = debtorID.String
+	link.ProductName = productName.String
+	return &link, nil
+}
+
+func (p *Postgres) FindPrice(ctx context.Context, amount int64, currency, environment, productName string) (string, string, error) {
+	var productID, priceID string
+	err := p.sb.Select("product_id", "price_id").
+		From("payment_links").
+		Where(sq.Eq{"amount": amount, "currency": currency, "environment": environment, "product_name": productName}).
+		Limit(1).
+		QueryRowContext(ctx).
+		Scan(&productID, &priceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrNotFound
+	}
+	return productID, priceID, err
+}
+
+func (p *Postgres) FindProduct(ctx context.Context, environment, productName string) (string, error) {
+	var productID string
+	err := p.sb.Select("product_id").
+		From("payment_links").
+		Where(sq.Eq{"environment": environment, "product_name": productName}).
+		Limit(1).
+		QueryRowContext(ctx).
+		Scan(&productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return productID, err
+}
+
+func (p *Postgres) DeactivatePaymentLink(ctx context.Context, id string) error {
+	_, err := p.sb.Update("payment_links").
+		Set("active", false).
+		Where(sq.Eq{"id": id}).
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) CountInactivePaymentLinks(ctx context.Context, caseID, environment string) (int, error) {
+	var count int
+	err := p.sb.Select("COUNT(*)").
+		From("payment_links").
+		Where(sq.Eq{
+			"case_id":         caseID,
+			"environment":     environment,
+			"active":          false,
+			"payment_plan_id": nil,
+		}).
+		QueryRowContext(ctx).
+		Scan(&count)
+	return count, err
+}
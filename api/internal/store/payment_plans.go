@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	PaymentPlanActive    = "active"
+	PaymentPlanCompleted = "completed"
+
+	InstallmentPending = "pending"
+	InstallmentPaid    = "paid"
+	InstallmentFailed  = "failed"
+)
+
+// PaymentPlan splits the debt of a case into installments, each paid through
+// its own Stripe payment link. Amounts are in the currency's minor unit.
+type PaymentPlan struct {
+	ID           string        `json:"id"`
+	CaseID       string        `json:"case_id"`
+	DebtorID     string        `json:"debtor_id,omitempty"`
+	Amount       int64         `json:"amount"`
+	Currency     string        `json:"currency"`
+	Environment  string        `json:"environment"`
+	Status       string        `json:"status"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Installments []Installment `json:"installments"`
+}
+
+type Installment struct {
+	Number        int        `json:"number"`
+	Amount        int64      `json:"amount"`
+	DueDate       time.Time  `json:"due_date"`
+	Status        string     `json:"status"`
+	PaymentLinkID string     `json:"payment_link_id"`
+	PaymentURL    string     `json:"payment_url"`
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+}
+
+type PaymentPlanStore interface {
+	// CreatePaymentPlan stores a plan with its installments. Creating a known
+	// plan again is a no-op.
+	CreatePaymentPlan(ctx context.Context, plan *PaymentPlan) error
+	GetPaymentPlan(ctx context.Context, id string) (*PaymentPlan, error)
+	// ListCasePaymentPlans and ListDebtorPaymentPlans return plans oldest
+	// first.
+	ListCasePaymentPlans(ctx context.Context, caseID string) ([]PaymentPlan, error)
+	ListDebtorPaymentPlans(ctx context.Context, debtorID string) ([]PaymentPlan, error)
+	// UpdateInstallmentStatus sets the status of the installment paid through
+	// paymentLinkID and returns its plan, completed once every installment is
+	// paid. A paid installment stays paid. It returns ErrNotFound when the
+	// link does not belong to a plan.
+	UpdateInstallmentStatus(ctx context.Context, paymentLinkID, status string, at time.Time) (*PaymentPlan, error)
+}
+
+// paid reports whether every installment has been paid.
+func (plan PaymentPlan) paid() bool {
+	for _, in := range plan.Installments {
+		if in.Status != InstallmentPaid {
+			return false
+		}
+	}
+	return true
+}
+
+func (plan PaymentPlan) clone() PaymentPlan {
+	plan.Installments = append([]Installment{}, plan.Installments...)
+	return plan
+}
+
+func (p *Postgres) CreatePaymentPlan(ctx context.Context, plan *PaymentPlan) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sb := p.sb.RunWith(tx)
+
+	if _, err := sb.Insert("payment_plans").
+		Columns("id", "case_id", "debtor_id", "amount", "currency", "environment", "status", "created_at").
+		Values(plan.ID, plan.CaseID, nullString(plan.DebtorID), plan.Amount, plan.Currency, plan.Environment,
+			plan.Status, plan.CreatedAt).
+		Suffix("ON CONFLICT (id) DO NOTHING").
+		ExecContext(ctx); err != nil {
+		return err
+	}
+
+	if len(plan.Installments) > 0 {
+		insert := sb.Insert("payment_installments").
+			Columns("plan_id", "number", "amount", "due_date", "status", "payment_link_id", "payment_url", "paid_at").
+			Suffix("ON CONFLICT (plan_id, number) DO NOTHING")
+		for _, in := range plan.Installments {
+			insert = insert.Values(plan.ID, in.Number, in.Amount, in.DueDate, in.Status, in.PaymentLinkID,
+				in.PaymentURL, in.PaidAt)
+		}
+		if _, err := insert.ExecContext(ctx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *Postgres) GetPaymentPlan(ctx context.Context, id string) (*PaymentPlan, error) {
+	plans, err := p.listPaymentPlans(ctx, sq.Eq{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return nil, ErrNotFound
+	}
+	return &plans[0], nil
+}
+
+func (p *Postgres) ListCasePaymentPlans(ctx context.Context, caseID string) ([]PaymentPlan, error) {
+	return p.listPaymentPlans(ctx, sq.Eq{"case_id": caseID})
+}
+
+func (p *Postgres) ListDebtorPaymentPlans(ctx context.Context, debtorID string) ([]PaymentPlan, error) {
+	return p.listPaymentPlans(ctx, sq.Eq{"debtor_id": debtorID})
+}
+
+func (p *Postgres) UpdateInstallmentStatus(ctx context.Context, paymentLinkID, status string, at time.Time) (*PaymentPlan, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sb := p.sb.RunWith(tx)
+
+	var planID string
+	err = sb.Select("plan_id").
+		From("payment_installments").
+		Where(sq.Eq{"payment_link_id": paymentLinkID}).
+		QueryRowContext(ctx).
+		Scan(&planID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	update := sb.Update("payment_installments").
+		Set("status", status).
+		Where(sq.Eq{"payment_link_id": paymentLinkID}).
+		Where(sq.NotEq{"status": InstallmentPaid})
+	if status == InstallmentPaid {
+		update = update.Set("paid_at", at)
+	}
+	if _, err := update.ExecContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := sb.Update("payment_plans").
+		Set("status", PaymentPlanCompleted).
+		Where(sq.Eq{"id": planID}).
+		Where(`NOT EXISTS (SELECT 1 FROM payment_installments
+			WHERE plan_id = payment_plans.id AND status <> ?)`, InstallmentPaid).
+		ExecContext(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p.GetPaymentPlan(ctx, planID)
+}
+
+func (p *Postgres) listPaymentPlans(ctx context.Context, where sq.Eq) ([]PaymentPlan, error) {
+	rows, err := p.sb.Select("id", "case_id", "debtor_id", "amount", "currency", "environment", "status", "created_at").
+		From("payment_plans").
+		Where(where).
+		OrderBy("created_at").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []PaymentPlan{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var plan PaymentPlan
+		var debtorID sql.NullString
+		if err := rows.Scan(&plan.ID, &plan.CaseID, &debtorID, &plan.Amount, &plan.Currency,
+			&plan.Environment, &plan.Status, &plan.CreatedAt); err != nil {
+			return nil, err
+		}
+		plan.DebtorID = debtorID.String
+		plan.Installments = []Installment{}
+		index[plan.ID] = len(plans)
+		plans = append(plans, plan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(plans) == 0 {
+		return plans, nil
+	}
+
+	ids := make([]string, 0, len(plans))
+	for _, plan := range plans {
+		ids = append(ids, plan.ID)
+	}
+
+	rows, err = p.sb.Select("plan_id", "number", "amount", "due_date", "status", "payment_link_id", "payment_url", "paid_at").
+		From("payment_installments").
+		Where(sq.Eq{"plan_id": ids}).
+		OrderBy("plan_id", "number").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var planID string
+		var in Installment
+		var paidAt sql.NullTime
+		if err := rows.Scan(&planID, &in.Number, &in.Amount, &in.DueDate, &in.Status,
+			&in.PaymentLinkID, &in.PaymentURL, &paidAt); err != nil {
+			return nil, err
+		}
+		if paidAt.Valid {
+			in.PaidAt = &paidAt.Time
+		}
+		plan := &plans[index[planID]]
+		plan.Installments = append(plan.Installments, in)
+	}
+
+	return plans, rows.Err()
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"claimsio/internal/money"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	PaymentPending   = "pending"
+	PaymentSucceeded = "succeeded"
+	PaymentFailed    = "failed"
+)
+
+// Payment is a Stripe payment made through a debtor's payment link, keyed by
+// its payment intent.
+type Payment struct {
+	PaymentIntentID   string `json:"payment_intent_id"`
+	CheckoutSessionID string `json:"checkout_session_id,omitempty"`
+	PaymentLinkID     string `json:"payment_link_id,omitempty"`
+	DebtorID          string `json:"debtor_id,omitempty"`
+	CaseID            string `json:"case_id,omitempty"`
+	// in the currency's minor unit
+	Amount         int64     `json:"amount"`
+	Currency       string    `json:"currency,omitempty"`
+	Status         string    `json:"status"`
+	FailureMessage string    `json:"failure_message,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Money returns the amount of the payment, or an error for a currency the
+// money package does not know.
+func (p Payment) Money() (money.Money, error) {
+	return money.New(p.Amount, p.Currency)
+}
+
+type PaymentStore interface {
+	// SavePayment creates or updates a payment. Empty fields keep their
+	// stored value and a succeeded payment stays succeeded, so Stripe events
+	// may arrive in any order.
+	SavePayment(ctx context.Context, payment *Payment) error
+	GetPayment(ctx context.Context, paymentIntentID string) (*Payment, error)
+}
+
+func (p *Postgres) SavePayment(ctx context.Context, payment *Payment) error {
+	_, err := p.sb.Insert("payments").
+		Columns("payment_intent_id", "checkout_session_id", "payment_link_id", "debtor_id", "case_id",
+			"amount", "currency", "status", "failure_message", "updated_at").
+		Values(payment.PaymentIntentID, nullString(payment.CheckoutSessionID), nullString(payment.PaymentLinkID),
+			nullString(payment.DebtorID), nullString(payment.CaseID), payment.Amount, nullString(payment.Currency),
+			payment.Status, nullString(payment.FailureMessage), payment.UpdatedAt).
+		Suffix(`ON CONFLICT (payment_intent_id) DO UPDATE SET
+			checkout_session_id = COALESCE(EXCLUDED.checkout_session_id, payments.checkout_session_id),
+			payment_link_id = COALESCE(EXCLUDED.payment_link_id, payments.payment_link_id),
+			debtor_id = COALESCE(EXCLUDED.debtor_id, payments.debtor_id),
+			case_id = COALESCE(EXCLUDED.case_id, payments.case_id),
+			amount = CASE WHEN EXCLUDED.amount > 0 THEN EXCLUDED.amount ELSE payments.amount END,
+			currency = COALESCE(EXCLUDED.currency, payments.currency),
+			status = CASE WHEN payments.status = 'succeeded' THEN payments.status ELSE EXCLUDED.status END,
+			failure_message = COALESCE(EXCLUDED.failure_message, payments.failure_message),
+			updated_at = EXCLUDED.updated_at`).
+		ExecContext(ctx)
+	return err
+}
+
+func (p *Postgres) GetPayment(ctx context.Context, paymentIntentID string) (*Payment, error) {
+	payment := Payment{PaymentIntentID: paymentIntentID}
+	var checkoutSessionID, paymentLinkID, debtorID, caseID, currency, failureMessage sql.NullString
+
+	err := p.sb.Select("checkout_session_id", "payment_link_id", "debtor_id", "case_id",
+		"amount", "currency", "status", "failure_message", "updated_at").
+		From("payments").
+		Where(sq.Eq{"payment_intent_id": paymentIntentID}).
+		QueryRowContext(ctx).
+		Scan(&checkoutSessionID, &paymentLinkID, &debtorID, &caseID,
+			&payment.Amount, &currency, &payment.Status, &failureMessage, &payment.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	payment.CheckoutSessionID = checkoutSessionID.String
+	payment.PaymentLinkID = paymentLinkID.String
+	payment.DebtorID = debtorID.String
+	payment.CaseID = caseID.String
+	payment.Currency = currency.String
+	payment.FailureMessage = failureMessage.String
+	return &payment, nil
+}
+
+// merge applies the SavePayment rules to a stored payment.
+func (p Payment) merge(update Payment) Payment {
+	keep := func(stored, updated string) string {
+		if updated == "" {
+			return stored
+		}
+		return updated
+	}
+	p.CheckoutSessionID = keep(p.CheckoutSessionID, update.CheckoutSessionID)
+	p.PaymentLinkID = keep(p.PaymentLinkID, update.PaymentLinkID)
+	p.DebtorID = keep(p.DebtorID, update.DebtorID)
+	p.CaseID = keep(p.CaseID, update.CaseID)
+	p.Currency = keep(p.Currency, update.Currency)
+	p.FailureMessage = keep(p.FailureMessage, update.FailureMessage)
+	if update.Amount > 0 {
+		p.Amount = update.Amount
+	}
+	if p.Status != PaymentSucceeded {
+		p.Status = update.Status
+	}
+	p.UpdatedAt = update.UpdatedAt
+	return p
+}
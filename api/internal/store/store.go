@@ -0,0 +1,82 @@
+// Package store persists call and payment data in Postgres. An in-memory
+// implementation with the same behaviour is used in tests and, when asked for
+// explicitly, in development.
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	_ "github.com/lib/pq"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Store is everything the service keeps in the database.
+type Store interface {
+	CallStore
+	TranscriptStore
+	ContactStore
+	OptOutStore
+	MessageStore
+	PaymentStore
+	PaymentLinkStore
+	PaymentPlanStore
+	CaseStore
+	Close() error
+}
+
+// Postgres is the Supabase backed Store.
+type Postgres struct {
+	db *sql.DB
+	sb sq.StatementBuilderType
+}
+
+// Open connects to the database at pgURL (SUPABASE_PG_URL).
+func Open(pgURL string) (*Postgres, error) {
+	db, err := sql.Open("postgres", pgURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return NewPostgres(db), nil
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{
+		db: db,
+		sb: sq.StatementBuilder.PlaceholderFormat(sq.Dollar).RunWith(db),
+	}
+}
+
+func (p *Postgres) DB() *sql.DB {
+	return p.db
+}
+
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
+
+// New returns the store of the given kind, "postgres" or "memory". Postgres
+// needs pgURL; an empty one is an error rather than a silent fallback to
+// memory, which would lose every record on restart.
+func New(kind, pgURL string) (Store, error) {
+	switch kind {
+	case "memory":
+		return NewMemory(), nil
+	case "postgres":
+		if pgURL == "" {
+			return nil, fmt.Errorf("postgres store requires a database URL")
+		}
+		return Open(pgURL)
+	default:
+		return nil, fmt.Errorf("unknown store %q", kind)
+	}
+}
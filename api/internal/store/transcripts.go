@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// TranscriptTurn is one utterance in a call, spoken by "agent" or "user".
+type TranscriptTurn struct {
+	Speaker   string    `json:"speaker"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type TranscriptStore interface {
+	// SaveTranscript replaces the stored transcript of a call.
+	SaveTranscript(ctx context.Context, callSid string, turns []TranscriptTurn) error
+	GetTranscript(ctx context.Context, callSid string) ([]TranscriptTurn, error)
+}
+
+func (p *Postgres) SaveTranscript(ctx context.Context, callSid string, turns []TranscriptTurn) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sb := p.sb.RunWith(tx)
+
+	if _, err := sb.Delete("call_transcript_turns").
+		Where(sq.Eq{"call_sid": callSid}).
+		ExecContext(ctx); err != nil {
+		return err
+	}
+
+	if len(turns) > 0 {
+		insert := sb.Insert("call_transcript_turns").
+			Columns("call_sid", "seq", "speaker", "text", "spoken_at")
+		for i, turn := range turns {
+			insert = insert.Values(callSid, i, turn.Speaker, turn.Text, turn.Timestamp)
+		}
+		if _, err := insert.ExecContext(ctx); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *Postgres) GetTranscript(ctx context.Context, callSid string) ([]TranscriptTurn, error) {
+	rows, err := p.sb.Select("speaker", "text", "spoken_at").
+		From("call_transcript_turns").
+		Where(sq.Eq{"call_sid": callSid}).
+		OrderBy("seq").
+		QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	turns := []TranscriptTurn{}
+	for rows.Next() {
+		var turn TranscriptTurn
+		if err := rows.Scan(&turn.Speaker, &turn.Text, &turn.Timestamp); err != nil {
+			return nil, err
+		}
+		turns = append(turns, turn)
+	}
+
+	return turns, rows.Err()
+}